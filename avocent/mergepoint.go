@@ -0,0 +1,175 @@
+// -*- go -*-
+
+package avocent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// KvmAvocentDriver is Avocent MergePoint specific folder for KVM driver.
+type KvmAvocentDriver struct {
+	Host     string
+	Username string
+	Password string
+	Version  int
+	Port     int
+
+	InsecureSkipVerify bool
+
+	client *http.Client
+}
+
+const (
+	// DefaultUsername is the default username on Avocent MergePoint
+	DefaultUsername = "Admin"
+	// DefaultPassword is the default password on Avocent MergePoint
+	DefaultPassword = ""
+)
+
+func init() {
+	kvm.Register(kvm.Vendor{
+		Name:            "avocent",
+		Aliases:         []string{"mergepoint", "mpu"},
+		Description:     "Avocent MergePoint Unity switch (needs --port)",
+		DefaultUsername: DefaultUsername,
+		DefaultPassword: DefaultPassword,
+		New: func(opts kvm.Options) kvm.Driver {
+			return &KvmAvocentDriver{
+				Host:     opts.Host,
+				Username: opts.Username,
+				Password: opts.Password,
+				Version:  opts.Version,
+				Port:     opts.Port,
+
+				InsecureSkipVerify: opts.InsecureSkipVerify,
+			}
+		},
+		Fingerprint: fingerprint,
+		ProbePaths:  probePaths,
+	})
+}
+
+// fingerprint recognizes a MergePoint by its certificate
+func fingerprint(p *kvm.Probe) *kvm.Match {
+	subject := p.CertificateSubject()
+	if !strings.Contains(subject, "Avocent") {
+		return nil
+	}
+	return &kvm.Match{Version: -1, Reason: fmt.Sprintf("TLS certificate subject %q", subject)}
+}
+
+// probePaths recognizes the MergePoint login page
+func probePaths(p *kvm.Probe) *kvm.Match {
+	if !p.Contains("/", "MergePoint") {
+		return nil
+	}
+	return &kvm.Match{Version: -1, Reason: "login page mentions MergePoint"}
+}
+
+// passwordFieldRe matches the password input of the login form
+var passwordFieldRe = regexp.MustCompile(`(?i)<input[^>]+name=["']?password\b`)
+
+// Viewer logs in to the switch and downloads the video session
+// JNLP connected to the target port
+func (d *KvmAvocentDriver) Viewer() (string, error) {
+	if d.Port <= 0 {
+		return "", fmt.Errorf("no target port given for %s: %w", d.Host, kvm.ErrPortRequired)
+	}
+
+	d.client = kvm.NewHTTPClient(d.InsecureSkipVerify)
+	d.client.Jar, _ = cookiejar.New(nil)
+
+	values := url.Values{"username": {d.Username}, "password": {d.Password}}
+	res, err := d.client.PostForm("https://"+d.Host+"/login.php", values)
+	if err != nil {
+		d.client = nil
+		return "", fmt.Errorf("couldn't login to MergePoint (%v): %w", err, kvm.ErrUnreachable)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		d.client = nil
+		return "", fmt.Errorf("couldn't login to MergePoint (%s)", res.Status)
+	}
+	// A successful login redirects away from login.php, a refused one
+	// stays on it and shows the password field again
+	if path.Base(res.Request.URL.Path) == "login.php" && passwordFieldRe.Match(body) {
+		d.client = nil
+		return "", fmt.Errorf("login to MergePoint refused: %w", kvm.ErrAuthFailed)
+	}
+
+	log.Printf("Connecting to MergePoint port %d", d.Port)
+	values = url.Values{"target": {strconv.Itoa(d.Port)}}
+	res, err = d.client.Get("https://" + d.Host + "/kvm.jnlp?" + values.Encode())
+	if err != nil {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp for port %d (%s)", d.Port, res.Status)
+	}
+
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		d.Close()
+		return "", err
+	}
+	if !bytes.Contains(body, []byte("<jnlp")) {
+		d.Close()
+		return "", errors.New("no jnlp returned by MergePoint")
+	}
+	viewer, err := jnlp.Normalize(body)
+	if err != nil {
+		d.Close()
+	}
+	return viewer, err
+}
+
+// Close logs out of the switch session opened by Viewer
+func (d *KvmAvocentDriver) Close() error {
+	if d.client == nil {
+		return nil
+	}
+	client := d.client
+	d.client = nil
+
+	res, err := client.Get("https://" + d.Host + "/logout.php")
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// GetHost return Configured driver Host
+func (d *KvmAvocentDriver) GetHost() string {
+	return d.Host
+}
+
+// GetUsername return Configured driver Username
+func (d *KvmAvocentDriver) GetUsername() string {
+	return d.Username
+}
+
+// GetPassword return Configured driver Password
+func (d *KvmAvocentDriver) GetPassword() string {
+	return d.Password
+}
+
+// EOF
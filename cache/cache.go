@@ -0,0 +1,278 @@
+// -*- go -*-
+
+// Package cache keeps the viewer jars downloaded from BMCs, keyed by
+// vendor, firmware version and URL, so they are only fetched again
+// when the BMC serves a different file.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotCached is returned in offline mode for files never downloaded
+var ErrNotCached = errors.New("not in cache")
+
+// Record describes a cached file, it is stored as JSON next to it
+type Record struct {
+	Vendor   string
+	Firmware string
+	URL      string
+	// Path is the cached file, it is not stored in the record
+	Path         string `json:"-"`
+	SHA256       string
+	Size         int64
+	ETag         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+	Fetched      time.Time
+	Used         time.Time
+}
+
+// Cache is a jar cache rooted at Dir
+type Cache struct {
+	Dir string
+	// Client downloads the files, http.DefaultClient when nil
+	Client *http.Client
+	// Offline uses cached files without revalidating them
+	Offline bool
+}
+
+// DefaultDir returns the cache directory in the user cache dir,
+// e.g. ~/.cache/drac-kvm on Linux
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "drac-kvm"), nil
+}
+
+// unsafeRe matches what is not kept of vendor and firmware names
+var unsafeRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// filename returns where url of vendor/firmware is cached
+func (c *Cache) filename(vendor string, firmware string, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	base := path.Base(strings.SplitN(url, "?", 2)[0])
+	return filepath.Join(c.Dir, unsafeRe.ReplaceAllString(vendor, "_"),
+		unsafeRe.ReplaceAllString(firmware, "_"),
+		hex.EncodeToString(sum[:8])+"-"+unsafeRe.ReplaceAllString(base, "_"))
+}
+
+// Fetch returns the path of the cached copy of url, downloading it
+// when missing, revalidating it with the server otherwise. A cached
+// copy is used as is when the server can't be reached.
+func (c *Cache) Fetch(vendor string, firmware string, url string) (string, error) {
+	filename := c.filename(vendor, firmware, url)
+	record, err := readRecord(filename)
+	if err == nil {
+		if err := record.verify(); err != nil {
+			log.Printf("Dropping cached %s (%s)", url, err)
+			remove(filename)
+			record = nil
+		}
+	} else {
+		record = nil
+	}
+
+	if c.Offline {
+		if record == nil {
+			return "", fmt.Errorf("%s: %w", url, ErrNotCached)
+		}
+		return filename, record.use()
+	}
+
+	fetched, err := c.download(filename, url, record)
+	if err != nil {
+		if record != nil {
+			log.Printf("Unable to revalidate %s (%s), using cached copy", url, err)
+			return filename, record.use()
+		}
+		return "", err
+	}
+	fetched.Vendor = vendor
+	fetched.Firmware = firmware
+	return filename, fetched.use()
+}
+
+// download fetches url into filename, sending the validators of a
+// cached record, and returns the record of the file
+func (c *Cache) download(filename string, url string, record *Record) (*Record, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		if record.ETag != "" {
+			req.Header.Set("If-None-Match", record.ETag)
+		}
+		if record.LastModified != "" {
+			req.Header.Set("If-Modified-Since", record.LastModified)
+		}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified && record != nil {
+		return record, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("couldn't download %s (%s)", url, res.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".download")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), res.Body)
+	if err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("couldn't download %s (%v)", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Cached %s", url)
+	return &Record{
+		URL:          url,
+		Path:         filename,
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+		Size:         size,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+	}, nil
+}
+
+// List returns the records of every cached file, sorted by path
+func (c *Cache) List() ([]*Record, error) {
+	var records []*Record
+	err := filepath.Walk(c.Dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(name, ".json") {
+			return nil
+		}
+		record, err := readRecord(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			return nil
+		}
+		records = append(records, record)
+		return nil
+	})
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Path < records[j].Path })
+	return records, err
+}
+
+// Prune removes the files not used for maxAge and those failing their
+// integrity check, it returns the removed records
+func (c *Cache) Prune(maxAge time.Duration) ([]*Record, error) {
+	records, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []*Record
+	for _, record := range records {
+		if time.Since(record.Used) > maxAge || record.verify() != nil {
+			if err := remove(record.Path); err != nil {
+				return removed, err
+			}
+			removed = append(removed, record)
+		}
+	}
+	return removed, nil
+}
+
+// readRecord reads the record of the cached file filename
+func readRecord(filename string) (*Record, error) {
+	data, err := ioutil.ReadFile(filename + ".json")
+	if err != nil {
+		return nil, err
+	}
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	record.Path = filename
+	return &record, nil
+}
+
+// verify checks the cached file against its SHA-256
+func (r *Record) verify() error {
+	f, err := os.Open(r.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != r.SHA256 {
+		return errors.New("SHA-256 mismatch")
+	}
+	return nil
+}
+
+// use marks the record used now and saves it
+func (r *Record) use() error {
+	r.Used = time.Now()
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.Path+".json", data, 0600)
+}
+
+// remove deletes a cached file and its record
+func remove(filename string) error {
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(filename + ".json"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// EOF
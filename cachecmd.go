@@ -0,0 +1,62 @@
+// -*- go -*-
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/utsl42/drac-kvm/cache"
+
+	"github.com/ogier/pflag"
+)
+
+// runCache runs the jar cache subcommands, cache list and cache prune
+func runCache(args []string) {
+	flags := pflag.NewFlagSet("cache", pflag.ExitOnError)
+	maxAge := flags.Duration("max-age", 30*24*time.Hour, "Prune jars not used for this long")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s cache (list|prune):\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		log.Fatalf("Unable to find the cache directory (%s)", err)
+	}
+	c := &cache.Cache{Dir: dir}
+
+	switch flags.Arg(0) {
+	case "list":
+		records, err := c.List()
+		if err != nil {
+			log.Fatalf("Unable to list %s (%s)", dir, err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "VENDOR\tFIRMWARE\tSIZE\tUSED\tURL")
+		for _, r := range records {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", r.Vendor, r.Firmware, r.Size,
+				r.Used.Format("2006-01-02"), r.URL)
+		}
+		w.Flush()
+
+	case "prune":
+		removed, err := c.Prune(*maxAge)
+		for _, r := range removed {
+			log.Printf("Removed %s (%s %s)", r.URL, r.Vendor, r.Firmware)
+		}
+		if err != nil {
+			log.Fatalf("Unable to prune %s (%s)", dir, err)
+		}
+
+	default:
+		flags.Usage()
+		os.Exit(1)
+	}
+}
+
+// EOF
@@ -0,0 +1,216 @@
+// -*- go -*-
+
+package cisco
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// KvmCiscoDriver is Cisco specific folder for KVM driver.
+type KvmCiscoDriver struct {
+	Host     string
+	Username string
+	Password string
+	Version  int
+
+	InsecureSkipVerify bool
+
+	client *http.Client
+	cookie string
+}
+
+const (
+	// DefaultUsername is the default username on Cisco CIMC
+	DefaultUsername = "admin"
+	// DefaultPassword is the default password on Cisco CIMC
+	DefaultPassword = "password"
+)
+
+func init() {
+	kvm.Register(kvm.Vendor{
+		Name:            "cisco",
+		Aliases:         []string{"cimc", "ucs"},
+		Description:     "Cisco UCS C-series CIMC",
+		DefaultUsername: DefaultUsername,
+		DefaultPassword: DefaultPassword,
+		New: func(opts kvm.Options) kvm.Driver {
+			return &KvmCiscoDriver{
+				Host:     opts.Host,
+				Username: opts.Username,
+				Password: opts.Password,
+				Version:  opts.Version,
+
+				InsecureSkipVerify: opts.InsecureSkipVerify,
+			}
+		},
+		Fingerprint: fingerprint,
+		ProbePaths:  probePaths,
+	})
+}
+
+// fingerprint recognizes a CIMC by its certificate, Redfish
+// service root or its XML API endpoint
+func fingerprint(p *kvm.Probe) *kvm.Match {
+	var reason string
+
+	if subject := p.CertificateSubject(); strings.Contains(subject, "Cisco") {
+		reason = fmt.Sprintf("TLS certificate subject %q", subject)
+	} else if p.RedfishVendor("Cisco") {
+		reason = "Redfish service root names Cisco"
+	}
+	if reason == "" {
+		return nil
+	}
+
+	return &kvm.Match{Version: -1, Reason: reason}
+}
+
+// probePaths recognizes the CIMC XML API answering an empty request
+func probePaths(p *kvm.Probe) *kvm.Match {
+	if !p.Contains("/nuova", "errorCode") {
+		return nil
+	}
+	return &kvm.Match{Version: -1, Reason: "/nuova XML API answers"}
+}
+
+// apiResponse holds the attributes of a CIMC XML API answer we use
+type apiResponse struct {
+	OutCookie  string `xml:"outCookie,attr"`
+	OutTokens  string `xml:"outTokens,attr"`
+	ErrorCode  string `xml:"errorCode,attr"`
+	ErrorDescr string `xml:"errorDescr,attr"`
+}
+
+// call posts a method to the CIMC XML API at /nuova
+func (d *KvmCiscoDriver) call(method interface{}) (*apiResponse, error) {
+	body, err := xml.Marshal(method)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := d.client.Post("https://"+d.Host+"/nuova", "text/xml", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't reach CIMC XML API (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CIMC XML API error (%s)", res.Status)
+	}
+
+	var response apiResponse
+	if err := xml.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("couldn't decode CIMC XML API response: %v", err)
+	}
+	return &response, nil
+}
+
+// Viewer logs in with aaaLogin, asks for a pair of KVM tokens for
+// the session and downloads the KVM viewer JNLP with them
+func (d *KvmCiscoDriver) Viewer() (string, error) {
+	d.client = kvm.NewHTTPClient(d.InsecureSkipVerify)
+
+	login, err := d.call(struct {
+		XMLName    xml.Name `xml:"aaaLogin"`
+		InName     string   `xml:"inName,attr"`
+		InPassword string   `xml:"inPassword,attr"`
+	}{InName: d.Username, InPassword: d.Password})
+	if err != nil {
+		return "", err
+	}
+	if login.ErrorCode != "" || login.OutCookie == "" {
+		return "", fmt.Errorf("CIMC login refused (%s %s): %w", login.ErrorCode, login.ErrorDescr, kvm.ErrAuthFailed)
+	}
+	d.cookie = login.OutCookie
+
+	tokens, err := d.call(struct {
+		XMLName xml.Name `xml:"aaaGetComputeAuthTokens"`
+		Cookie  string   `xml:"cookie,attr"`
+	}{Cookie: d.cookie})
+	if err != nil {
+		d.Close()
+		return "", err
+	}
+	tkn := strings.Split(tokens.OutTokens, ",")
+	if tokens.ErrorCode != "" || len(tkn) != 2 {
+		d.Close()
+		return "", fmt.Errorf("couldn't get KVM tokens (%s %s)", tokens.ErrorCode, tokens.ErrorDescr)
+	}
+
+	values := url.Values{"cimcAddr": {d.Host}, "tkn1": {tkn[0]}, "tkn2": {tkn[1]}}
+	res, err := d.client.Get("https://" + d.Host + "/kvm.jnlp?" + values.Encode())
+	if err != nil {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp (%s)", res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		d.Close()
+		return "", err
+	}
+	if !bytes.Contains(body, []byte("<jnlp")) {
+		d.Close()
+		return "", errors.New("CIMC did not return a jnlp")
+	}
+	viewer, err := jnlp.Normalize(body)
+	if err != nil {
+		d.Close()
+	}
+	return viewer, err
+}
+
+// Close logs out of the CIMC session with aaaLogout, the KVM tokens
+// of the viewer are tied to it, so it must not be called while the
+// viewer runs
+func (d *KvmCiscoDriver) Close() error {
+	if d.cookie == "" {
+		return nil
+	}
+	cookie := d.cookie
+	d.cookie = ""
+
+	logout, err := d.call(struct {
+		XMLName  xml.Name `xml:"aaaLogout"`
+		Cookie   string   `xml:"cookie,attr"`
+		InCookie string   `xml:"inCookie,attr"`
+	}{Cookie: cookie, InCookie: cookie})
+	if err != nil {
+		return err
+	}
+	if logout.ErrorCode != "" {
+		return fmt.Errorf("couldn't logout from CIMC (%s %s)", logout.ErrorCode, logout.ErrorDescr)
+	}
+	return nil
+}
+
+// GetHost return Configured driver Host
+func (d *KvmCiscoDriver) GetHost() string {
+	return d.Host
+}
+
+// GetUsername return Configured driver Username
+func (d *KvmCiscoDriver) GetUsername() string {
+	return d.Username
+}
+
+// GetPassword return Configured driver Password
+func (d *KvmCiscoDriver) GetPassword() string {
+	return d.Password
+}
+
+// EOF
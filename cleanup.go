@@ -0,0 +1,56 @@
+// -*- go -*-
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// tempDirs are the private directories holding the JNLP, VNC password
+// and java.security files of this session, they are removed however
+// drac-kvm exits
+var tempDirs struct {
+	sync.Mutex
+	dirs []string
+}
+
+// removeOnExit registers dir for removal by removeTempDirs
+func removeOnExit(dir string) {
+	tempDirs.Lock()
+	defer tempDirs.Unlock()
+	tempDirs.dirs = append(tempDirs.dirs, dir)
+}
+
+// removeTempDirs removes the registered directories
+func removeTempDirs() {
+	tempDirs.Lock()
+	defer tempDirs.Unlock()
+	for _, dir := range tempDirs.dirs {
+		os.RemoveAll(dir)
+	}
+	tempDirs.dirs = nil
+}
+
+// handleSignals cleans up when drac-kvm is interrupted or terminated
+func handleSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-c
+		log.Printf("Caught %s, cleaning up", sig)
+		removeTempDirs()
+		os.Exit(1)
+	}()
+}
+
+// fatalf is log.Fatalf removing the temporary directories first
+func fatalf(format string, v ...interface{}) {
+	removeTempDirs()
+	log.Fatalf(format, v...)
+}
+
+// EOF
@@ -7,4 +7,14 @@ func DefaultJavaPath() string {
 	return "/usr/bin/javaws"
 }
 
+// DefaultBrowser is the default command opening URLs on macOS
+func DefaultBrowser() string {
+	return "open"
+}
+
+// DefaultVNCViewer is the default VNC viewer command on macOS
+func DefaultVNCViewer() string {
+	return "vncviewer"
+}
+
 // EOF
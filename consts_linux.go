@@ -7,4 +7,14 @@ func DefaultJavaPath() string {
 	return "/usr/bin/javaws"
 }
 
+// DefaultBrowser is the default command opening URLs on Linux
+func DefaultBrowser() string {
+	return "xdg-open"
+}
+
+// DefaultVNCViewer is the default VNC viewer command on Linux
+func DefaultVNCViewer() string {
+	return "vncviewer"
+}
+
 // EOF
@@ -2,30 +2,21 @@
 
 package main
 
-import (
-	"os"
-	"path/filepath"
-)
-
-var (
-	javaRoots   = []string{"C:\\Program Files\\Java\\", "C:\\Program Files (x86)\\Java\\"}
-	winJavaPath = "" //C:\\Program Files (x86)\\Java\\jre7\\bin\\javaws.exe
-)
-
-// DefaultJavaPath is the default Java path on Windows
+// DefaultJavaPath is the default Java path on Windows, javaws.exe is
+// looked up in the PATH (Oracle installers add their javapath to it)
+// when the selected Java runtime has none
 func DefaultJavaPath() string {
-	//javaws lives in a folder with a version number on Windows, so we can search for javaws.exe
-	for _, r := range javaRoots {
-		filepath.Walk(r, visit)
-	}
-	return winJavaPath
+	return "javaws.exe"
+}
+
+// DefaultBrowser is the default command opening URLs on Windows
+func DefaultBrowser() string {
+	return "rundll32 url.dll,FileProtocolHandler"
 }
 
-func visit(path string, f os.FileInfo, err error) error {
-	if winJavaPath == "" && f.Name() == "javaws.exe" {
-		winJavaPath = path
-	}
-	return nil
+// DefaultVNCViewer is the default VNC viewer command on Windows
+func DefaultVNCViewer() string {
+	return "vncviewer.exe"
 }
 
 // EOF
@@ -0,0 +1,216 @@
+// -*- go -*-
+
+package dell
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// dellFirmwareVersions maps early iDRAC7 firmware releases, which
+// have their own DellTemplates entry, to their version number
+var dellFirmwareVersions = map[string]int{
+	"1.03": 103,
+	"1.04": 104,
+}
+
+// loginMarkers are matched against the iDRAC login page when no
+// firmware information endpoint answered, newest generation first
+var loginMarkers = []struct {
+	re      *regexp.Regexp
+	version int
+}{
+	{regexp.MustCompile(`(?i)idrac\s*9|/restgui/`), 9},
+	{regexp.MustCompile(`(?i)idrac\s*8`), 8},
+	{regexp.MustCompile(`(?i)idrac\s*7`), 7},
+	{regexp.MustCompile(`(?i)idrac\s*6|Remote Access Controller 6`), 6},
+	{regexp.MustCompile(`(?i)\bdrac\s*5|Remote Access Controller 5`), 5},
+}
+
+// generationRe extracts the PowerEdge generation ("12G", "13G", ...)
+// from the model strings reported by Redfish and the bmc info endpoint
+var generationRe = regexp.MustCompile(`(\d+)G`)
+
+// DetectVersion probes the iDRAC web interface over HTTPS and returns
+// the matching DellTemplates version and the firmware version, empty
+// when only the login page told the version. It tries the firmware
+// info endpoint, Redfish and finally markers on the login page.
+func DetectVersion(client *http.Client, host string, username string, password string) (int, string, error) {
+	return detectVersion(func(path string) ([]byte, error) {
+		if strings.HasPrefix(path, "/redfish/") {
+			return get(client, "https://"+host+path, username, password)
+		}
+		return get(client, "https://"+host+path, "", "")
+	})
+}
+
+// detectVersion is DetectVersion with get fetching a path of the
+// iDRAC, it returns a nil body for anything but 200
+func detectVersion(get func(path string) ([]byte, error)) (int, string, error) {
+	var lastErr error
+	reached := false
+
+	// iDRAC9 and late iDRAC8 firmware answer this one without a session
+	var info struct {
+		Attributes struct {
+			FwVer            string
+			SystemGeneration string
+		}
+	}
+	if body, err := get("/sysmgmt/2015/bmc/info"); err == nil {
+		reached = true
+		if body != nil && json.Unmarshal(body, &info) == nil {
+			if version, ok := fromGeneration(info.Attributes.SystemGeneration, info.Attributes.FwVer); ok {
+				return version, info.Attributes.FwVer, nil
+			}
+		}
+	} else {
+		lastErr = err
+	}
+
+	// Redfish is available on iDRAC7/8 firmware 2.x and later
+	var manager struct {
+		Model           string
+		FirmwareVersion string
+	}
+	if body, err := get("/redfish/v1/Managers/iDRAC.Embedded.1"); err == nil {
+		reached = true
+		if body != nil && json.Unmarshal(body, &manager) == nil {
+			if version, ok := fromGeneration(manager.Model, manager.FirmwareVersion); ok {
+				return version, manager.FirmwareVersion, nil
+			}
+		}
+	} else {
+		lastErr = err
+	}
+
+	// Fall back to the login page, every generation names itself there
+	for _, page := range []string{"/login.html", "/"} {
+		body, err := get(page)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		reached = true
+		for _, marker := range loginMarkers {
+			if marker.re.Match(body) {
+				return marker.version, "", nil
+			}
+		}
+	}
+
+	if !reached {
+		return -1, "", fmt.Errorf("unable to detect DRAC version (%v): %w", lastErr, kvm.ErrUnreachable)
+	}
+	return -1, "", fmt.Errorf("unable to detect DRAC version: %w", kvm.ErrUnsupportedVersion)
+}
+
+// fingerprint recognizes an iDRAC by its certificate or Redfish
+// service root and detects its version
+func fingerprint(p *kvm.Probe) *kvm.Match {
+	var reason string
+
+	if subject := p.CertificateSubject(); strings.Contains(subject, "Dell") {
+		reason = fmt.Sprintf("TLS certificate subject %q", subject)
+	} else if p.RedfishVendor("Dell") {
+		reason = "Redfish service root names Dell"
+	}
+	if reason == "" {
+		return nil
+	}
+	return match(p, reason)
+}
+
+// probePaths recognizes the iDRAC login page
+func probePaths(p *kvm.Probe) *kvm.Match {
+	res, err := p.Get("/login.html")
+	if err != nil || res.StatusCode != http.StatusOK {
+		return nil
+	}
+	for _, marker := range loginMarkers {
+		if found := marker.re.Find(res.Body); found != nil {
+			return match(p, fmt.Sprintf("login page mentions %s", found))
+		}
+	}
+	return nil
+}
+
+// match returns a Match with the iDRAC version detected from the
+// responses the probe keeps
+func match(p *kvm.Probe, reason string) *kvm.Match {
+	version, _, err := detectVersion(func(path string) ([]byte, error) {
+		res, err := p.Get(path)
+		if err != nil || res.StatusCode != http.StatusOK {
+			return nil, err
+		}
+		return res.Body, nil
+	})
+	if err != nil {
+		version = -1
+	}
+	return &kvm.Match{Version: version, Reason: reason}
+}
+
+// fromGeneration converts a PowerEdge generation and firmware
+// version into a DellTemplates version
+func fromGeneration(model string, firmware string) (int, bool) {
+	m := generationRe.FindStringSubmatch(model)
+	if m == nil {
+		return -1, false
+	}
+	generation, _ := strconv.Atoi(m[1])
+
+	log.Printf("Found PowerEdge %dG with iDRAC firmware %s", generation, firmware)
+
+	switch {
+	case generation <= 10:
+		return 5, true
+	case generation == 11:
+		return 6, true
+	case generation == 12:
+		for prefix, version := range dellFirmwareVersions {
+			if strings.HasPrefix(firmware, prefix) {
+				return version, true
+			}
+		}
+		return 7, true
+	case generation == 13:
+		return 8, true
+	default:
+		return 9, true
+	}
+}
+
+// get fetches url, using basic auth if a username was given, and
+// returns the body of a successful response. Error responses return
+// a nil body, only transport failures are reported as an error.
+func get(client *http.Client, url string, username string, password string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// EOF
@@ -0,0 +1,38 @@
+// -*- go -*-
+
+package dell
+
+const viewer5 string = `<?xml version="1.0" encoding="UTF-8"?>
+<jnlp codebase="https://{{ .Host }}:443" spec="1.0+">
+<information>
+  <title>DRAC5 Virtual KVM Client</title>
+  <vendor>Dell Inc.</vendor>
+  <shortcut online="true"/>
+ </information>
+ <application-desc main-class="com.avocent.kvm.client.Main">
+   <argument>title=DRAC KVM: {{ .Host }}</argument>
+   <argument>ip={{ .Host }}</argument>
+   <argument>user={{ .Username }}</argument>
+   <argument>passwd={{ .Password }}</argument>
+   <argument>kmport=5900</argument>
+   <argument>vport=5900</argument>
+   <argument>apcp=1</argument>
+   <argument>version=1</argument>
+ </application-desc>
+ <security>
+   <all-permissions/>
+ </security>
+ <resources>
+   <j2se version="1.6 1.5 1.4+"/>
+   <jar href="https://{{ .Host }}:443/software/avctKVM.jar" download="eager" main="true" />
+ </resources>
+ <resources os="Windows">
+   <nativelib href="https://{{ .Host }}:443/software/avctKVMIOWin32.jar" download="eager"/>
+ </resources>
+ <resources os="Linux">
+   <nativelib href="https://{{ .Host }}:443/software/avctKVMIOLinux.jar" download="eager"/>
+ </resources>
+</jnlp>
+`
+
+// EOF
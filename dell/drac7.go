@@ -2,8 +2,7 @@
 
 package dell
 
-const viewer7 string = `
-<?xml version="1.0" encoding="UTF-8"?>
+const viewer7 string = `<?xml version="1.0" encoding="UTF-8"?>
 <jnlp codebase="https://{{ .Host }}:443" spec="1.0+">
 <information>
   <title>iDRAC7 Virtual Console Client</title>
@@ -3,20 +3,33 @@
 package dell
 
 import (
-	"bytes"
-	"errors"
 	"fmt"
 	"log"
-	"text/template"
+	"strconv"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
 )
 
 // KvmDellDriver is Dell specific folder for KVM driver.
-//
 type KvmDellDriver struct {
 	Host     string
 	Username string
 	Password string
 	Version  int
+
+	// VNCPassword is the password of the iDRAC VNC server
+	VNCPassword string
+
+	InsecureSkipVerify bool
+
+	// firmware is the firmware version found by DetectVersion
+	firmware string
+
+	// session is the web API session of token based viewers
+	session *session
+	// redfish is the Redfish session of iDRAC9 HTML5 consoles
+	redfish *redfishSession
 }
 
 const (
@@ -29,6 +42,7 @@ const (
 // DellTemplates is a map of each viewer.jnlp template for
 // the various Dell iDRAC versions, keyed by version number
 var DellTemplates = map[int]string{
+	5:   viewer5,
 	6:   viewer6,
 	7:   viewer7,
 	8:   viewer8,
@@ -36,27 +50,166 @@ var DellTemplates = map[int]string{
 	104: viewer7,
 }
 
-// Viewer returns a viewer.jnlp template filled out with the
-// necessary details to connect to a particular DRAC host
+func init() {
+	kvm.Register(kvm.Vendor{
+		Name:            "dell",
+		Aliases:         []string{"idrac", "drac"},
+		Description:     "Dell DRAC5 / iDRAC",
+		DefaultUsername: DefaultUsername,
+		DefaultPassword: DefaultPassword,
+		Versions:        []int{5, 6, 7, 8, 9, 103, 104},
+		New: func(opts kvm.Options) kvm.Driver {
+			return &KvmDellDriver{
+				Host:     opts.Host,
+				Username: opts.Username,
+				Password: opts.Password,
+				Version:  opts.Version,
+
+				VNCPassword: opts.VNCPassword,
+
+				InsecureSkipVerify: opts.InsecureSkipVerify,
+			}
+		},
+		Fingerprint: fingerprint,
+		ProbePaths:  probePaths,
+	})
+}
+
+// Viewer returns a viewer.jnlp for a particular DRAC host. iDRAC7/8
+// hand out a JNLP carrying one-time session tokens, DRAC5, iDRAC6 (and
+// firmware without a web API) get a template filled out with the
+// username and password.
 func (d *KvmDellDriver) Viewer() (string, error) {
 
-	// Check we have a valid DRAC viewer template for this DRAC version
-	if d.Version < 0 {
-		return "", errors.New("unable to detect DRAC version")
+	if err := d.detectVersion(); err != nil {
+		return "", err
+	}
+
+	if d.Version == 9 {
+		return "", fmt.Errorf("iDRAC9 has no Java viewer, use its HTML5 console: %w", kvm.ErrUnsupportedVersion)
 	}
 
+	// Check we have a valid DRAC viewer template for this DRAC version
 	if _, ok := DellTemplates[d.Version]; !ok {
-		msg := fmt.Sprintf("no support for DRAC v%d", d.Version)
-		return "", errors.New(msg)
+		return "", fmt.Errorf("no support for DRAC v%d: %w", d.Version, kvm.ErrUnsupportedVersion)
 	}
 
-	log.Printf("Found iDRAC version %d", d.Version)
+	if d.Version > 6 {
+		jnlp, err := d.sessionViewer()
+		if err != errNoSessionAPI {
+			return jnlp, err
+		}
+		log.Printf("iDRAC firmware has no session login, using template")
+	}
 
 	// Generate a JNLP viewer from the template
 	// Injecting the host/user/pass information
-	buff := bytes.NewBufferString("")
-	err := template.Must(template.New("viewer").Parse(DellTemplates[d.Version])).Execute(buff, d)
-	return buff.String(), err
+	return jnlp.Execute(DellTemplates[d.Version], map[string]string{
+		"Host":     d.Host,
+		"Username": d.Username,
+		"Password": d.Password,
+	})
+}
+
+// Console returns the HTML5 virtual console on iDRAC9 and the Java
+// viewer on older iDRACs
+func (d *KvmDellDriver) Console() (*kvm.Console, error) {
+
+	if err := d.detectVersion(); err != nil {
+		return nil, err
+	}
+
+	if d.Version != 9 {
+		viewer, err := d.Viewer()
+		if err != nil {
+			return nil, err
+		}
+		return &kvm.Console{Kind: kvm.JNLPConsole, JNLP: viewer}, nil
+	}
+
+	s, err := redfishLogin(kvm.NewHTTPClient(d.InsecureSkipVerify), d.Host, d.Username, d.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	consoleURL, err := s.consoleURL()
+	if err != nil {
+		s.logout()
+		return nil, err
+	}
+
+	d.redfish = s
+	return &kvm.Console{Kind: kvm.HTML5Console, URL: consoleURL}, nil
+}
+
+// detectVersion detects the DRAC version when none was given
+func (d *KvmDellDriver) detectVersion() error {
+	if d.Version < 0 {
+		log.Printf("Detecting iDRAC version...")
+		version, firmware, err := DetectVersion(kvm.NewHTTPClient(d.InsecureSkipVerify), d.Host, d.Username, d.Password)
+		if err != nil {
+			return err
+		}
+		d.Version = version
+		d.firmware = firmware
+	}
+	log.Printf("Found iDRAC version %d", d.Version)
+	return nil
+}
+
+// sessionViewer logs in to the iDRAC web API and fetches a viewer
+// JNLP for that session, the session stays open until Close
+func (d *KvmDellDriver) sessionViewer() (string, error) {
+	s, err := login(kvm.NewHTTPClient(d.InsecureSkipVerify), d.Host, d.Username, d.Password)
+	if err != nil {
+		return "", err
+	}
+
+	jnlp, err := s.viewer("DRAC KVM: " + d.Host)
+	if err != nil {
+		s.logout()
+		return "", err
+	}
+
+	d.session = s
+	return jnlp, nil
+}
+
+// Close logs out of the iDRAC session opened by Viewer or Console
+func (d *KvmDellDriver) Close() error {
+	var err error
+	if d.session != nil {
+		err = d.session.logout()
+		d.session = nil
+	}
+	if d.redfish != nil {
+		err = d.redfish.logout()
+		d.redfish = nil
+	}
+	return err
+}
+
+// Firmware returns the iDRAC firmware version found when detecting
+// the DRAC version, or the DRAC version when it was given or the
+// firmware did not tell it, viewer jars are cached per firmware
+func (d *KvmDellDriver) Firmware() string {
+	if d.firmware != "" {
+		return fmt.Sprintf("%d-%s", d.Version, d.firmware)
+	}
+	return strconv.Itoa(d.Version)
+}
+
+// Legacy returns what the viewer of the DRAC version needs: DRAC5 and
+// iDRAC6 only do TLS 1.0 with 1024-bit keys and MD5 signed jars, early
+// iDRAC7 firmware lacks TLS 1.2
+func (d *KvmDellDriver) Legacy() kvm.Legacy {
+	switch {
+	case d.Version <= 6:
+		return kvm.LegacyAll
+	case d.Version == 7 || d.Version == 103 || d.Version == 104:
+		return kvm.LegacyTLS | kvm.LegacyWeakKeys
+	}
+	return 0
 }
 
 // GetHost return Configured driver Host
@@ -0,0 +1,109 @@
+// -*- go -*-
+
+package dell
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// kvmSessionAction is the Dell OEM Redfish action handing out
+// temporary credentials for the HTML5 virtual console
+const kvmSessionAction = "/redfish/v1/Dell/Managers/iDRAC.Embedded.1/DelliDRACCardService/Actions/DelliDRACCardService.GetKVMSession"
+
+// redfishSession is a Redfish session on an iDRAC9
+type redfishSession struct {
+	client   *http.Client
+	host     string
+	token    string
+	location string
+}
+
+// redfishLogin opens a Redfish session on the iDRAC
+func redfishLogin(client *http.Client, host string, username string, password string) (*redfishSession, error) {
+	body, _ := json.Marshal(map[string]string{"UserName": username, "Password": password})
+
+	res, err := client.Post("https://"+host+"/redfish/v1/SessionService/Sessions", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't login to iDRAC (%v): %w", err, kvm.ErrUnreachable)
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("iDRAC login refused (%s): %w", res.Status, kvm.ErrAuthFailed)
+	}
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("couldn't login to iDRAC (%s)", res.Status)
+	}
+
+	s := &redfishSession{
+		client:   client,
+		host:     host,
+		token:    res.Header.Get("X-Auth-Token"),
+		location: res.Header.Get("Location"),
+	}
+	if s.token == "" {
+		return nil, fmt.Errorf("no X-Auth-Token in iDRAC login response: %w", kvm.ErrAuthFailed)
+	}
+	return s, nil
+}
+
+// consoleURL obtains a virtual console session and returns the
+// URL opening it without a manual login
+func (s *redfishSession) consoleURL() (string, error) {
+	body, _ := json.Marshal(map[string]string{"SessionTypeName": "vConsole"})
+
+	req, _ := http.NewRequest("POST", "https://"+s.host+kvmSessionAction, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Auth-Token", s.token)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get KVM session (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't get KVM session (%s)", res.Status)
+	}
+
+	var kvmSession struct {
+		TempUsername string
+		TempPassword string
+	}
+	if err := json.NewDecoder(res.Body).Decode(&kvmSession); err != nil {
+		return "", fmt.Errorf("couldn't decode KVM session: %v", err)
+	}
+
+	values := url.Values{"username": {kvmSession.TempUsername}, "tempPassword": {kvmSession.TempPassword}}
+	return "https://" + s.host + "/console?" + values.Encode(), nil
+}
+
+// logout deletes the Redfish session
+func (s *redfishSession) logout() error {
+	if s.location == "" {
+		return nil
+	}
+	location := s.location
+	if location[0] == '/' {
+		location = "https://" + s.host + location
+	}
+
+	req, _ := http.NewRequest("DELETE", location, nil)
+	req.Header.Set("X-Auth-Token", s.token)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("couldn't logout from iDRAC (%s)", res.Status)
+	}
+	return nil
+}
+
+// EOF
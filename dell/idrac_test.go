@@ -0,0 +1,36 @@
+// -*- go -*-
+
+package dell
+
+import (
+	"testing"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+)
+
+func TestTemplates(t *testing.T) {
+	values := map[string]string{
+		"Host":     "10.0.0.1",
+		"Username": `root&"admin"`,
+		"Password": `a&<b>"c'd`,
+	}
+	for version, template := range DellTemplates {
+		out, err := jnlp.Execute(template, values)
+		if err != nil {
+			t.Errorf("v%d: %v", version, err)
+			continue
+		}
+		doc, err := jnlp.Parse([]byte(out))
+		if err != nil {
+			t.Errorf("v%d: %v", version, err)
+			continue
+		}
+		for name, want := range map[string]string{"ip": values["Host"], "user": values["Username"], "passwd": values["Password"]} {
+			if got, _ := doc.Argument(name); got != want {
+				t.Errorf("v%d: %s = %q, want %q", version, name, got, want)
+			}
+		}
+	}
+}
+
+// EOF
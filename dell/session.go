@@ -0,0 +1,135 @@
+// -*- go -*-
+
+package dell
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// errNoSessionAPI is returned by login when the firmware has no
+// web API to log in with
+var errNoSessionAPI = errors.New("iDRAC firmware has no session login")
+
+// session is a logged in iDRAC7/8 web API session, the viewer it
+// hands out carries one-time tokens instead of the password
+type session struct {
+	client *http.Client
+	host   string
+	st1    string
+	st2    string
+}
+
+// loginResponse is the XML answer of /data/login
+type loginResponse struct {
+	Status     string `xml:"status"`
+	AuthResult int    `xml:"authResult"`
+	ForwardURL string `xml:"forwardUrl"`
+}
+
+// login opens a web API session on the iDRAC
+func login(client *http.Client, host string, username string, password string) (*session, error) {
+	jar, _ := cookiejar.New(nil)
+	client.Jar = jar
+
+	values := url.Values{"user": {username}, "password": {password}}
+	res, err := client.PostForm("https://"+host+"/data/login", values)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't login to iDRAC (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errNoSessionAPI
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("couldn't login to iDRAC (%s)", res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result loginResponse
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return nil, errNoSessionAPI
+	}
+	if result.AuthResult != 0 {
+		return nil, fmt.Errorf("iDRAC login refused (authResult %d): %w", result.AuthResult, kvm.ErrAuthFailed)
+	}
+
+	// forwardUrl looks like index.html?ST1=<token>,ST2=<token>
+	s := &session{client: client, host: host}
+	if i := strings.Index(result.ForwardURL, "?"); i >= 0 {
+		for _, param := range strings.Split(result.ForwardURL[i+1:], ",") {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "ST1":
+				s.st1 = kv[1]
+			case "ST2":
+				s.st2 = kv[1]
+			}
+		}
+	}
+	if s.st1 == "" {
+		s.logout()
+		return nil, errNoSessionAPI
+	}
+
+	return s, nil
+}
+
+// viewer downloads the virtual console JNLP for this session
+func (s *session) viewer(title string) (string, error) {
+	launch := fmt.Sprintf("https://%s/viewer.jnlp(%s@0@%s@%d@ST1=%s)", s.host, s.host,
+		url.PathEscape(title), time.Now().UnixNano()/int64(time.Millisecond), s.st1)
+
+	res, err := s.client.Get(launch)
+	if err != nil {
+		return "", fmt.Errorf("couldn't fetch jnlp (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't fetch jnlp (%s)", res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Contains(body, []byte("<jnlp")) {
+		return "", errors.New("iDRAC did not return a jnlp")
+	}
+	return jnlp.Normalize(body)
+}
+
+// logout closes the web API session
+func (s *session) logout() error {
+	req, _ := http.NewRequest("GET", "https://"+s.host+"/data/logout", nil)
+	req.Header.Set("ST2", s.st2)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("couldn't logout from iDRAC (%s)", res.Status)
+	}
+	return nil
+}
+
+// EOF
@@ -0,0 +1,78 @@
+// -*- go -*-
+
+package dell
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// defaultVNCPort is the port of the iDRAC VNC server unless
+// VNCServer.1.Port was changed
+const defaultVNCPort = 5901
+
+// VNCConsole returns the iDRAC7/8/9 VNC server, which has to be
+// enabled beforehand (racadm set iDRAC.VNCServer.Enable Enabled)
+func (d *KvmDellDriver) VNCConsole() (*kvm.Console, error) {
+	if err := d.detectVersion(); err != nil {
+		return nil, err
+	}
+	if d.Version <= 6 {
+		return nil, fmt.Errorf("DRAC v%d has no VNC server: %w", d.Version, kvm.ErrVNCUnsupported)
+	}
+
+	port := defaultVNCPort
+	enabled, configured, ok := d.vncAttributes()
+	if ok {
+		if !enabled {
+			return nil, fmt.Errorf("VNC server disabled on %s, enable it with racadm set iDRAC.VNCServer.Enable Enabled: %w", d.Host, kvm.ErrVNCUnsupported)
+		}
+		port = configured
+	} else {
+		log.Printf("Unable to read iDRAC VNC server settings, trying port %d", port)
+	}
+
+	password := d.VNCPassword
+	if password == "" {
+		password = d.Password
+	}
+	return &kvm.Console{
+		Kind:     kvm.VNCConsole,
+		Addr:     net.JoinHostPort(d.Host, strconv.Itoa(port)),
+		Password: password,
+	}, nil
+}
+
+// vncAttributes reads the VNC server settings from the Redfish
+// manager attributes, ok is false when they are not available
+// (firmware older than 2.40)
+func (d *KvmDellDriver) vncAttributes() (enabled bool, port int, ok bool) {
+	body, err := get(kvm.NewHTTPClient(d.InsecureSkipVerify),
+		"https://"+d.Host+"/redfish/v1/Managers/iDRAC.Embedded.1/Attributes", d.Username, d.Password)
+	if err != nil || body == nil {
+		return false, 0, false
+	}
+
+	var attributes struct {
+		Attributes struct {
+			Enable string `json:"VNCServer.1.Enable"`
+			Port   int    `json:"VNCServer.1.Port"`
+		}
+	}
+	if err := json.Unmarshal(body, &attributes); err != nil || attributes.Attributes.Enable == "" {
+		return false, 0, false
+	}
+
+	port = attributes.Attributes.Port
+	if port == 0 {
+		port = defaultVNCPort
+	}
+	return attributes.Attributes.Enable == "Enabled", port, true
+}
+
+// EOF
@@ -0,0 +1,23 @@
+// -*- go -*-
+
+package main
+
+// Vendor drivers register themselves with the kvm package from their
+// init function. Additional (e.g. internal) drivers only need to be
+// imported here, or from another file of this package.
+import (
+	_ "github.com/utsl42/drac-kvm/avocent"
+	_ "github.com/utsl42/drac-kvm/cisco"
+	_ "github.com/utsl42/drac-kvm/dell"
+	_ "github.com/utsl42/drac-kvm/fujitsu"
+	_ "github.com/utsl42/drac-kvm/hp"
+	_ "github.com/utsl42/drac-kvm/huawei"
+	_ "github.com/utsl42/drac-kvm/lenovo"
+	_ "github.com/utsl42/drac-kvm/megarac"
+	_ "github.com/utsl42/drac-kvm/openbmc"
+	_ "github.com/utsl42/drac-kvm/oracle"
+	_ "github.com/utsl42/drac-kvm/raritan"
+	_ "github.com/utsl42/drac-kvm/supermicro"
+)
+
+// EOF
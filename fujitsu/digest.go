@@ -0,0 +1,137 @@
+// -*- go -*-
+
+package fujitsu
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// digestGet fetches url using HTTP digest authentication (RFC 2617),
+// which is how the iRMC protects its web interface. Firmware asking
+// for basic authentication gets that instead, a 401 without any of
+// both challenges is returned as is.
+func digestGet(client *http.Client, url string, username string, password string) (*http.Response, error) {
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusUnauthorized {
+		return res, nil
+	}
+
+	header := res.Header.Get("WWW-Authenticate")
+	challenge := parseChallenge(header)
+	basic := strings.HasPrefix(strings.ToLower(header), "basic")
+	if challenge == nil && !basic {
+		return res, nil
+	}
+	res.Body.Close()
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		req.Header.Set("Authorization", challenge.authorize(req.Method, req.URL.RequestURI(), username, password))
+	} else {
+		req.SetBasicAuth(username, password)
+	}
+	return client.Do(req)
+}
+
+// digestChallenge holds the parameters of a WWW-Authenticate: Digest header
+type digestChallenge struct {
+	realm  string
+	nonce  string
+	opaque string
+	qop    string
+}
+
+// parseChallenge parses a WWW-Authenticate header, it returns nil
+// if the server did not ask for digest authentication
+func parseChallenge(header string) *digestChallenge {
+	if !strings.HasPrefix(header, "Digest ") {
+		return nil
+	}
+
+	c := &digestChallenge{}
+	for _, param := range splitParams(header[len("Digest "):]) {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.Trim(kv[1], `"`)
+		switch kv[0] {
+		case "realm":
+			c.realm = value
+		case "nonce":
+			c.nonce = value
+		case "opaque":
+			c.opaque = value
+		case "qop":
+			// Several qop values may be offered, we only do "auth"
+			for _, qop := range strings.Split(value, ",") {
+				if strings.TrimSpace(qop) == "auth" {
+					c.qop = "auth"
+				}
+			}
+		}
+	}
+	return c
+}
+
+// authorize returns the Authorization header answering the challenge
+func (c *digestChallenge) authorize(method string, uri string, username string, password string) string {
+	ha1 := md5hex(username + ":" + c.realm + ":" + password)
+	ha2 := md5hex(method + ":" + uri)
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s"`, quote(username), c.realm, c.nonce, uri)
+	if c.qop == "auth" {
+		cnonce := make([]byte, 8)
+		rand.Read(cnonce)
+		nc := "00000001"
+		response := md5hex(ha1 + ":" + c.nonce + ":" + nc + ":" + hex.EncodeToString(cnonce) + ":auth:" + ha2)
+		header += fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%x", response="%s"`, nc, cnonce, response)
+	} else {
+		header += fmt.Sprintf(`, response="%s"`, md5hex(ha1+":"+c.nonce+":"+ha2))
+	}
+	if c.opaque != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, c.opaque)
+	}
+	return header
+}
+
+// splitParams splits comma separated challenge parameters, keeping
+// commas inside quoted values
+func splitParams(s string) []string {
+	var params []string
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			params = append(params, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(params, s[start:])
+}
+
+// quote escapes s for a quoted-string header value
+func quote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func md5hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// EOF
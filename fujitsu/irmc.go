@@ -0,0 +1,149 @@
+// -*- go -*-
+
+package fujitsu
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// KvmFujitsuDriver is Fujitsu specific folder for KVM driver.
+type KvmFujitsuDriver struct {
+	Host     string
+	Username string
+	Password string
+	Version  int
+
+	InsecureSkipVerify bool
+}
+
+const (
+	// DefaultUsername is the default username on Fujitsu iRMC
+	DefaultUsername = "admin"
+	// DefaultPassword is the default password on Fujitsu iRMC
+	DefaultPassword = "admin"
+)
+
+var (
+	// generationRe extracts the iRMC generation ("iRMC S4", "iRMC S5")
+	generationRe = regexp.MustCompile(`iRMC\s*S(\d)`)
+)
+
+func init() {
+	kvm.Register(kvm.Vendor{
+		Name:            "fujitsu",
+		Aliases:         []string{"irmc"},
+		Description:     "Fujitsu iRMC S4/S5 AVR",
+		DefaultUsername: DefaultUsername,
+		DefaultPassword: DefaultPassword,
+		Versions:        []int{4, 5},
+		New: func(opts kvm.Options) kvm.Driver {
+			return &KvmFujitsuDriver{
+				Host:     opts.Host,
+				Username: opts.Username,
+				Password: opts.Password,
+				Version:  opts.Version,
+
+				InsecureSkipVerify: opts.InsecureSkipVerify,
+			}
+		},
+		Fingerprint: fingerprint,
+	})
+}
+
+// fingerprint recognizes an iRMC by its Server header or certificate
+func fingerprint(p *kvm.Probe) *kvm.Match {
+	var reason string
+
+	if server := p.Server(); strings.Contains(server, "iRMC") {
+		reason = fmt.Sprintf("Server header %q", server)
+	} else if subject := p.CertificateSubject(); strings.Contains(strings.ToUpper(subject), "FUJITSU") {
+		reason = fmt.Sprintf("TLS certificate subject %q", subject)
+	} else if p.RedfishVendor("Fujitsu") || p.RedfishVendor("ts_fujitsu") {
+		reason = "Redfish service root names Fujitsu"
+	}
+	if reason == "" {
+		return nil
+	}
+
+	version := -1
+	if m := generationRe.FindStringSubmatch(p.Server()); m != nil {
+		version, _ = strconv.Atoi(m[1])
+	}
+	return &kvm.Match{Version: version, Reason: reason}
+}
+
+// Viewer digest-authenticates against the iRMC and downloads the
+// Advanced Video Redirection JNLP. Like the iLO template, the
+// JNLP then needs to point at the host we used to reach the iRMC.
+func (d *KvmFujitsuDriver) Viewer() (string, error) {
+	client := kvm.NewHTTPClient(d.InsecureSkipVerify)
+
+	res, err := digestGet(client, "https://"+d.Host+"/avr.jnlp", d.Username, d.Password)
+	if err != nil {
+		return "", fmt.Errorf("couldn't fetch AVR jnlp (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusUnauthorized {
+		return "", fmt.Errorf("couldn't login to iRMC (%s): %w", res.Status, kvm.ErrAuthFailed)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't fetch AVR jnlp (%s)", res.Status)
+	}
+
+	if m := generationRe.FindStringSubmatch(res.Header.Get("Server")); m != nil && d.Version < 0 {
+		d.Version, _ = strconv.Atoi(m[1])
+	}
+	if d.Version > 0 {
+		log.Printf("Found iRMC S%d", d.Version)
+	}
+
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Contains(bodyBytes, []byte("<jnlp")) {
+		return "", errors.New("iRMC did not return a jnlp")
+	}
+	doc, err := jnlp.Parse(bodyBytes)
+	if err != nil {
+		return "", err
+	}
+
+	// Point the codebase and every reference to the address the iRMC
+	// knows itself by at the host we reached it with
+	if codebase, err := url.Parse(doc.Codebase); err == nil && codebase.Hostname() != "" {
+		doc.RewriteHost(codebase.Hostname(), d.Host)
+	}
+
+	data, err := doc.Marshal()
+	return string(data), err
+}
+
+// GetHost return Configured driver Host
+func (d *KvmFujitsuDriver) GetHost() string {
+	return d.Host
+}
+
+// GetUsername return Configured driver Username
+func (d *KvmFujitsuDriver) GetUsername() string {
+	return d.Username
+}
+
+// GetPassword return Configured driver Password
+func (d *KvmFujitsuDriver) GetPassword() string {
+	return d.Password
+}
+
+// EOF
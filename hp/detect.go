@@ -0,0 +1,84 @@
+// -*- go -*-
+
+package hp
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// generationRe extracts the iLO generation from product names such
+// as "Integrated Lights-Out 4 (iLO 4)" or "iLO 5"
+var generationRe = regexp.MustCompile(`iLO\s*(\d+)`)
+
+// xmlData is the part of /xmldata?item=all we care about
+type xmlData struct {
+	MP struct {
+		PN   string `xml:"PN"`
+		FWRI string `xml:"FWRI"`
+	} `xml:"MP"`
+}
+
+// parseXMLData returns the iLO generation and firmware version
+// found in a /xmldata?item=all document
+func parseXMLData(body []byte) (int, string, bool) {
+	var data xmlData
+	if err := xml.Unmarshal(body, &data); err != nil {
+		return -1, "", false
+	}
+	m := generationRe.FindStringSubmatch(data.MP.PN)
+	if m == nil {
+		return -1, "", false
+	}
+	generation, _ := strconv.Atoi(m[1])
+	return generation, data.MP.FWRI, true
+}
+
+// DetectVersion returns the iLO generation and firmware version of
+// host. It reads /xmldata?item=all, which needs no login, and falls
+// back to the Redfish manager resource.
+func DetectVersion(client *http.Client, host string, username string, password string) (int, string, error) {
+	reached := false
+
+	res, err := client.Get("https://" + host + "/xmldata?item=all")
+	if err == nil {
+		reached = true
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if generation, firmware, ok := parseXMLData(body); ok {
+			return generation, firmware, nil
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "https://"+host+"/redfish/v1/Managers/1", nil)
+	req.SetBasicAuth(username, password)
+	res, err = client.Do(req)
+	if err == nil {
+		reached = true
+		defer res.Body.Close()
+		var manager struct {
+			Model           string
+			FirmwareVersion string
+		}
+		if res.StatusCode == http.StatusOK && json.NewDecoder(res.Body).Decode(&manager) == nil {
+			if m := generationRe.FindStringSubmatch(manager.Model); m != nil {
+				generation, _ := strconv.Atoi(m[1])
+				return generation, manager.FirmwareVersion, nil
+			}
+		}
+	}
+
+	if !reached {
+		return -1, "", fmt.Errorf("unable to detect iLO generation (%v): %w", err, kvm.ErrUnreachable)
+	}
+	return -1, "", fmt.Errorf("unable to detect iLO generation: %w", kvm.ErrUnsupportedVersion)
+}
+
+// EOF
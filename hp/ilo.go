@@ -4,24 +4,34 @@ package hp
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
-	"net"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
-	"time"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
 )
 
 // KvmHpDriver is HP specific folder for KVM driver.
-//
 type KvmHpDriver struct {
 	Host     string
 	Username string
 	Password string
 	Version  int
+
+	InsecureSkipVerify bool
+
+	// firmware is the iLO firmware version found by detectVersion
+	firmware string
+
+	// client and sessionKey keep the iLO session open until Close
+	client     *http.Client
+	sessionKey string
 }
 
 const (
@@ -31,80 +41,258 @@ const (
 	DefaultPassword = ""
 )
 
-// Viewer that logs in, fetch the sessionKey cookie to be able
-// to generate a correct jnlp. With HP we can use `jnlp_template.html`
-// url to fetch current jnlp template.
-func (d *KvmHpDriver) Viewer() (string, error) {
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-		Dial: func(netw, addr string) (net.Conn, error) {
-			deadline := time.Now().Add(5 * time.Second)
-			c, err := net.DialTimeout(netw, addr, time.Second*5)
-			if err != nil {
-				return nil, err
+func init() {
+	kvm.Register(kvm.Vendor{
+		Name:            "hp",
+		Aliases:         []string{"hpe", "ilo"},
+		Description:     "HP iLO 2/3/4/5/6",
+		DefaultUsername: DefaultUsername,
+		DefaultPassword: DefaultPassword,
+		Versions:        []int{2, 3, 4, 5, 6},
+		New: func(opts kvm.Options) kvm.Driver {
+			return &KvmHpDriver{
+				Host:     opts.Host,
+				Username: opts.Username,
+				Password: opts.Password,
+				Version:  opts.Version,
+
+				InsecureSkipVerify: opts.InsecureSkipVerify,
 			}
-			c.SetDeadline(deadline)
-			return c, nil
 		},
+		Fingerprint: fingerprint,
+		ProbePaths:  probePaths,
+	})
+}
+
+// fingerprint recognizes an iLO by its Server header, certificate or
+// Redfish service root
+func fingerprint(p *kvm.Probe) *kvm.Match {
+	var reason string
+
+	if server := p.Server(); strings.Contains(server, "iLO") {
+		reason = fmt.Sprintf("Server header %q", server)
+	} else if subject := p.CertificateSubject(); strings.Contains(subject, "Hewlett") {
+		reason = fmt.Sprintf("TLS certificate subject %q", subject)
+	} else if p.RedfishVendor("HPE") || p.RedfishVendor("Hp") {
+		reason = "Redfish service root names HPE"
 	}
+	if reason == "" {
+		return nil
+	}
+	return match(p, reason)
+}
 
-	client := &http.Client{
-		Transport: transport,
+// probePaths recognizes iLO by its unauthenticated XML data page
+func probePaths(p *kvm.Probe) *kvm.Match {
+	if !p.Contains("/xmldata?item=all", "<RIMP>") {
+		return nil
 	}
+	return match(p, "/xmldata?item=all answers")
+}
 
+// match returns a Match with the iLO generation when xmldata tells it
+func match(p *kvm.Probe, reason string) *kvm.Match {
+	version := -1
+	if res, err := p.Get("/xmldata?item=all"); err == nil {
+		if generation, _, ok := parseXMLData(res.Body); ok {
+			version = generation
+		}
+	}
+	return &kvm.Match{Version: version, Reason: reason}
+}
+
+// detectVersion detects the iLO generation when none was given
+func (d *KvmHpDriver) detectVersion(client *http.Client) error {
+	if d.Version < 0 {
+		log.Printf("Detecting iLO generation...")
+		generation, firmware, err := DetectVersion(client, d.Host, d.Username, d.Password)
+		if err != nil {
+			return err
+		}
+		d.Version = generation
+		d.firmware = firmware
+		log.Printf("Found iLO %d with firmware %s", d.Version, firmware)
+	} else {
+		log.Printf("Found iLO %d", d.Version)
+	}
+	return nil
+}
+
+// authFailures are the messages of iLO refusing credentials
+var authFailures = map[string]bool{
+	"JS_ERR_LOST_SESSION": true,
+	"JS_ERR_LOGIN_FAILED": true,
+}
+
+// login opens an iLO session and returns its session key, Close logs
+// out of it
+func (d *KvmHpDriver) login(client *http.Client) (string, error) {
 	// Post parameters to login to iLO
 	values := map[string]string{"method": "login", "user_login": d.Username, "password": d.Password}
 	jsonValue, _ := json.Marshal(values)
 
-	if res, err := client.Post("https://"+d.Host+"/json/login_session", "", bytes.NewBuffer(jsonValue)); err == nil {
-		defer res.Body.Close()
-		if res.StatusCode == 200 {
-			var f interface{}
+	res, err := client.Post("https://"+d.Host+"/json/login_session", "", bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return "", fmt.Errorf("couldn't login to iLO (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		// Refused credentials come as 401/403 or as an error message,
+		// anything else (503 session limit, 5xx, 404) is no auth error
+		var failure struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(res.Body).Decode(&failure)
+		if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden || authFailures[failure.Message] {
+			return "", fmt.Errorf("couldn't login to iLO (%s): %w", res.Status, kvm.ErrAuthFailed)
+		}
+		if failure.Message != "" {
+			return "", fmt.Errorf("couldn't login to iLO (%s %s)", res.Status, failure.Message)
+		}
+		return "", fmt.Errorf("couldn't login to iLO (%s)", res.Status)
+	}
 
-			// Fetch sessionKey from json response using an
-			// interface in order to build a cookie
-			bodyBytes, _ := ioutil.ReadAll(res.Body)
-			err = json.Unmarshal(bodyBytes, &f)
+	// Fetch sessionKey from json response in order to build a cookie
+	var session struct {
+		SessionKey string `json:"session_key"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&session); err != nil {
+		return "", fmt.Errorf("couldn't decode iLO login response: %v", err)
+	}
+	if session.SessionKey == "" {
+		return "", fmt.Errorf("no session key in iLO login response: %w", kvm.ErrAuthFailed)
+	}
+	d.client = client
+	d.sessionKey = session.SessionKey
+	return session.SessionKey, nil
+}
 
-			if err != nil {
-				fmt.Println("Couldn't decode json", err)
-			}
+// Console returns the Java integrated remote console on iLO 2/3/4 and
+// the HTML5 integrated remote console on iLO 5/6
+func (d *KvmHpDriver) Console() (*kvm.Console, error) {
+	client := kvm.NewHTTPClient(d.InsecureSkipVerify)
 
-			m := f.(map[string]interface{})
-			sessionKey := m["session_key"].(string)
+	if err := d.detectVersion(client); err != nil {
+		return nil, err
+	}
 
-			cookie := http.Cookie{Name: "sessionKey", Value: sessionKey}
-			req, _ := http.NewRequest("GET", "https://"+d.Host+"/html/jnlp_template.html", nil)
-			req.AddCookie(&cookie)
+	if d.Version < 5 {
+		viewer, err := d.Viewer()
+		if err != nil {
+			return nil, err
+		}
+		return &kvm.Console{Kind: kvm.JNLPConsole, JNLP: viewer}, nil
+	}
+
+	sessionKey, err := d.login(client)
+	if err != nil {
+		return nil, err
+	}
+
+	// The standalone IRC page picks the established session up from
+	// its sessionKey parameter, no login form is shown
+	values := url.Values{"sessionKey": {sessionKey}, "langId": {"en"}}
+	return &kvm.Console{Kind: kvm.HTML5Console, URL: "https://" + d.Host + "/irc.html?" + values.Encode()}, nil
+}
+
+// Viewer that logs in, fetch the sessionKey cookie to be able
+// to generate a correct jnlp. With HP we can use `jnlp_template.html`
+// url to fetch current jnlp template. Only iLO 3/4 have a Java
+// integrated remote console, iLO 2 its remote console applet.
+func (d *KvmHpDriver) Viewer() (string, error) {
+	client := kvm.NewHTTPClient(d.InsecureSkipVerify)
 
-			if res, err := client.Do(req); err == nil {
-				defer res.Body.Close()
-				if res.StatusCode == 200 {
-					bodyBytes, _ := ioutil.ReadAll(res.Body)
-					bodyString := string(bodyBytes)
+	if d.Version >= 5 {
+		return "", fmt.Errorf("iLO %d has no Java remote console, use its HTML5 console: %w", d.Version, kvm.ErrUnsupportedVersion)
+	}
+	if d.Version == 2 {
+		return d.ilo2Viewer()
+	}
 
-					// We need to:
-					// - replace placeholder with actual values
-					// - skip the first and last line of the jnlp
-					// template
-					r := strings.NewReplacer("<%= this.baseUrl %>", "https://"+d.Host+"/",
-						"<%= this.sessionKey %>", sessionKey,
-						"<%= this.langId %>", "en")
+	sessionKey, err := d.login(client)
+	if err != nil {
+		return "", err
+	}
 
-					jnlp := r.Replace(bodyString)
-					_jnlp := strings.Split(jnlp, "\n")
-					jnlp = strings.Join(_jnlp[1:len(_jnlp)-1], "\n")
+	cookie := http.Cookie{Name: "sessionKey", Value: sessionKey}
+	req, _ := http.NewRequest("GET", "https://"+d.Host+"/html/jnlp_template.html", nil)
+	req.AddCookie(&cookie)
 
-					return jnlp, err
-				}
+	res, err := client.Do(req)
+	if err != nil {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp template (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp template (%s)", res.Status)
+	}
 
-				return "", errors.New("Couldn't fetch jnlp template")
-			}
-		}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		d.Close()
+		return "", err
+	}
+	bodyString := string(bodyBytes)
+
+	// The template is wrapped in HTML, fill out its placeholders
+	// and let Normalize pick the document out of it
+	r := strings.NewReplacer("<%= this.baseUrl %>", jnlp.Escape("https://"+d.Host+"/"),
+		"<%= this.sessionKey %>", jnlp.Escape(sessionKey),
+		"<%= this.langId %>", "en")
+
+	viewer, err := jnlp.Normalize([]byte(r.Replace(bodyString)))
+	if err != nil {
+		d.Close()
+	}
+	return viewer, err
+}
+
+// Close logs out of the iLO session opened for the console, each
+// session left open takes one of the few iLO session slots
+func (d *KvmHpDriver) Close() error {
+	if d.sessionKey == "" {
+		return nil
+	}
+	client, sessionKey := d.client, d.sessionKey
+	d.client, d.sessionKey = nil, ""
+
+	values := map[string]string{"method": "logout", "session_key": sessionKey}
+	jsonValue, _ := json.Marshal(values)
+
+	req, _ := http.NewRequest("POST", "https://"+d.Host+"/json/login_session", bytes.NewBuffer(jsonValue))
+	req.AddCookie(&http.Cookie{Name: "sessionKey", Value: sessionKey})
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("couldn't logout from iLO (%s)", res.Status)
+	}
+	return nil
+}
+
+// Firmware returns the iLO firmware version, or the iLO generation
+// when it was not detected, viewer jars are cached per firmware
+func (d *KvmHpDriver) Firmware() string {
+	if d.firmware != "" {
+		return fmt.Sprintf("%d-%s", d.Version, d.firmware)
+	}
+	return strconv.Itoa(d.Version)
+}
+
+// Legacy returns what the viewer of the iLO generation needs, iLO 2
+// and 3 only do TLS 1.0 with RC4 and their applets are MD5 signed
+func (d *KvmHpDriver) Legacy() kvm.Legacy {
+	switch {
+	case d.Version <= 3:
+		return kvm.LegacyAll
+	case d.Version == 4:
+		return kvm.LegacyTLS
 	}
-	return "", errors.New("Couldn't login to iLO")
+	return 0
 }
 
 // GetHost return Configured driver Host
@@ -0,0 +1,140 @@
+// -*- go -*-
+
+package hp
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// iLO 2 has no JSON API, the remote console applet is embedded in
+// the drc2fram.html page of a form login session. Its applet tag and
+// parameters are turned into a JNLP applet-desc.
+var (
+	appletRe = regexp.MustCompile(`(?is)<applet\s([^>]*)>(.*?)</applet>`)
+	attrRe   = regexp.MustCompile(`(?i)(code|archive|codebase)\s*=\s*"([^"]*)"`)
+	paramRe  = regexp.MustCompile(`(?i)<param\s+name\s*=\s*"?([^"\s>]+)"?\s+value\s*=\s*"([^"]*)"`)
+)
+
+// ilo2Applet holds what the iLO 2 applet tag tells us
+type ilo2Applet struct {
+	Code    string
+	Archive string
+	Params  []jnlp.Param
+}
+
+// ilo2JNLP turns the applet of host into an applet-desc JNLP
+func ilo2JNLP(host string, applet *ilo2Applet) (string, error) {
+	doc := &jnlp.JNLP{
+		Spec:     "1.0+",
+		Codebase: "https://" + host + "/",
+		Information: []jnlp.Information{{
+			Title:  "iLO 2 Remote Console: " + host,
+			Vendor: "Hewlett-Packard",
+		}},
+		Security: &jnlp.Security{AllPermissions: &struct{}{}},
+		Resources: []jnlp.Resources{{
+			J2SE: []jnlp.J2SE{{Version: "1.5+"}},
+			Jars: []jnlp.Jar{{Href: applet.Archive, Main: "true"}},
+		}},
+		AppletDesc: &jnlp.AppletDesc{
+			MainClass: applet.Code,
+			Name:      "remcons",
+			Width:     "1024",
+			Height:    "768",
+			Params:    applet.Params,
+		},
+	}
+	data, err := doc.Marshal()
+	return string(data), err
+}
+
+// ilo2Viewer logs in through the iLO 2 login form and builds a JNLP
+// from the remote console applet
+func (d *KvmHpDriver) ilo2Viewer() (string, error) {
+	client := kvm.NewHTTPClient(d.InsecureSkipVerify)
+	client.Jar, _ = cookiejar.New(nil)
+
+	values := url.Values{"loginId": {d.Username}, "password": {d.Password}}
+	res, err := client.PostForm("https://"+d.Host+"/index.htm", values)
+	if err != nil {
+		return "", fmt.Errorf("couldn't login to iLO 2 (%v): %w", err, kvm.ErrUnreachable)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't login to iLO 2 (%s)", res.Status)
+	}
+
+	loggedIn := false
+	for _, cookie := range client.Jar.Cookies(res.Request.URL) {
+		if strings.HasPrefix(cookie.Name, "hp-iLO-") && cookie.Value != "" {
+			loggedIn = true
+		}
+	}
+	if !loggedIn {
+		return "", fmt.Errorf("login to iLO 2 refused: %w", kvm.ErrAuthFailed)
+	}
+
+	res, err = client.Get("https://" + d.Host + "/drc2fram.html")
+	if err != nil {
+		return "", fmt.Errorf("couldn't fetch remote console page (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't fetch remote console page (%s)", res.Status)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	applet, err := parseILO2Applet(body)
+	if err != nil {
+		return "", err
+	}
+	return ilo2JNLP(d.Host, applet)
+}
+
+// parseILO2Applet extracts the remote console applet from page
+func parseILO2Applet(page []byte) (*ilo2Applet, error) {
+	m := appletRe.FindSubmatch(page)
+	if m == nil {
+		return nil, errors.New("no remote console applet found (iLO 2 Advanced license needed)")
+	}
+
+	applet := &ilo2Applet{}
+	for _, attr := range attrRe.FindAllSubmatch(m[1], -1) {
+		switch strings.ToLower(string(attr[1])) {
+		case "code":
+			applet.Code = strings.TrimSuffix(string(attr[2]), ".class")
+		case "archive":
+			applet.Archive = string(attr[2])
+		}
+	}
+	if applet.Code == "" || applet.Archive == "" {
+		return nil, errors.New("incomplete remote console applet tag")
+	}
+	// The jar is relative to the BMC root, e.g. /rc175p09.jar
+	if !strings.HasPrefix(applet.Archive, "/") && !strings.Contains(applet.Archive, "://") {
+		applet.Archive = "/" + applet.Archive
+	}
+
+	for _, param := range paramRe.FindAllSubmatch(m[2], -1) {
+		// Parameter values come HTML escaped, Marshal escapes them
+		// again for the JNLP
+		applet.Params = append(applet.Params, jnlp.Param{Name: string(param[1]), Value: html.UnescapeString(string(param[2]))})
+	}
+	return applet, nil
+}
+
+// EOF
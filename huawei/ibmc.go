@@ -0,0 +1,267 @@
+// -*- go -*-
+
+package huawei
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// KvmHuaweiDriver is Huawei specific folder for KVM driver.
+type KvmHuaweiDriver struct {
+	Host     string
+	Username string
+	Password string
+	Version  int
+
+	InsecureSkipVerify bool
+
+	client   *http.Client
+	token    string
+	location string
+}
+
+const (
+	// DefaultUsername is the default username on Huawei iBMC
+	DefaultUsername = "Administrator"
+	// DefaultPassword is the default password on Huawei iBMC
+	DefaultPassword = "Admin@9000"
+)
+
+// html5Version is the first iBMC major firmware version serving
+// the HTML5 remote console
+const html5Version = 3
+
+// firmwareRe extracts the major iBMC firmware version, e.g. "3.18"
+var firmwareRe = regexp.MustCompile(`^(\d+)\.`)
+
+func init() {
+	kvm.Register(kvm.Vendor{
+		Name:            "huawei",
+		Aliases:         []string{"ibmc"},
+		Description:     "Huawei iBMC",
+		DefaultUsername: DefaultUsername,
+		DefaultPassword: DefaultPassword,
+		Versions:        []int{2, 3},
+		New: func(opts kvm.Options) kvm.Driver {
+			return &KvmHuaweiDriver{
+				Host:     opts.Host,
+				Username: opts.Username,
+				Password: opts.Password,
+				Version:  opts.Version,
+
+				InsecureSkipVerify: opts.InsecureSkipVerify,
+			}
+		},
+		Fingerprint: fingerprint,
+	})
+}
+
+// fingerprint recognizes an iBMC by its certificate or Redfish
+// service root
+func fingerprint(p *kvm.Probe) *kvm.Match {
+	var reason string
+
+	if subject := p.CertificateSubject(); strings.Contains(subject, "Huawei") {
+		reason = fmt.Sprintf("TLS certificate subject %q", subject)
+	} else if p.RedfishVendor("Huawei") {
+		reason = "Redfish service root names Huawei"
+	}
+	if reason == "" {
+		return nil
+	}
+
+	return &kvm.Match{Version: -1, Reason: reason}
+}
+
+// login opens a Redfish session on the iBMC
+func (d *KvmHuaweiDriver) login() error {
+	d.client = kvm.NewHTTPClient(d.InsecureSkipVerify)
+
+	body, _ := json.Marshal(map[string]string{"UserName": d.Username, "Password": d.Password})
+	res, err := d.client.Post("https://"+d.Host+"/redfish/v1/SessionService/Sessions", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("couldn't login to iBMC (%v): %w", err, kvm.ErrUnreachable)
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("iBMC login refused (%s): %w", res.Status, kvm.ErrAuthFailed)
+	}
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		return fmt.Errorf("couldn't login to iBMC (%s)", res.Status)
+	}
+
+	d.token = res.Header.Get("X-Auth-Token")
+	d.location = res.Header.Get("Location")
+	if d.token == "" {
+		return fmt.Errorf("no X-Auth-Token in iBMC login response: %w", kvm.ErrAuthFailed)
+	}
+	return nil
+}
+
+// request sends an authenticated Redfish request
+func (d *KvmHuaweiDriver) request(method string, path string, body interface{}) (*http.Response, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, "https://"+d.Host+path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Auth-Token", d.token)
+	return d.client.Do(req)
+}
+
+// detectVersion reads the iBMC firmware version from Redfish
+func (d *KvmHuaweiDriver) detectVersion() {
+	res, err := d.request("GET", "/redfish/v1/Managers/1", nil)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	var manager struct {
+		FirmwareVersion string
+	}
+	if res.StatusCode != http.StatusOK || json.NewDecoder(res.Body).Decode(&manager) != nil {
+		return
+	}
+	if m := firmwareRe.FindStringSubmatch(manager.FirmwareVersion); m != nil && d.Version < 0 {
+		d.Version, _ = strconv.Atoi(m[1])
+	}
+	log.Printf("Found iBMC version %d with firmware %s", d.Version, manager.FirmwareVersion)
+}
+
+// Console returns the HTML5 remote console on iBMC 3.x firmware and
+// the Java KVM viewer on older firmware
+func (d *KvmHuaweiDriver) Console() (*kvm.Console, error) {
+	if err := d.login(); err != nil {
+		return nil, err
+	}
+	d.detectVersion()
+
+	if d.Version < html5Version {
+		viewer, err := d.viewer()
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+		return &kvm.Console{Kind: kvm.JNLPConsole, JNLP: viewer}, nil
+	}
+
+	// The Huawei OEM action hands out a one-time console link
+	res, err := d.request("POST", "/redfish/v1/Managers/1/Actions/Oem/Huawei/Manager.GetKvmLink", map[string]string{"Mode": "Shared"})
+	if err != nil {
+		d.Close()
+		return nil, fmt.Errorf("couldn't get KVM link (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		d.Close()
+		return nil, fmt.Errorf("couldn't get KVM link (%s)", res.Status)
+	}
+
+	var link struct {
+		KvmLink string
+	}
+	if err := json.NewDecoder(res.Body).Decode(&link); err != nil || link.KvmLink == "" {
+		d.Close()
+		return nil, errors.New("iBMC did not return a KVM link")
+	}
+	// The console now authenticates with the link, not our session
+	d.Close()
+
+	consoleURL, err := url.Parse(link.KvmLink)
+	if err != nil {
+		return nil, err
+	}
+	consoleURL.Host = d.Host
+	return &kvm.Console{Kind: kvm.HTML5Console, URL: consoleURL.String()}, nil
+}
+
+// Viewer logs in and generates the Java KVM viewer JNLP
+func (d *KvmHuaweiDriver) Viewer() (string, error) {
+	if d.token == "" {
+		if err := d.login(); err != nil {
+			return "", err
+		}
+	}
+	viewer, err := d.viewer()
+	if err != nil {
+		d.Close()
+	}
+	return viewer, err
+}
+
+// viewer downloads the Java KVM JNLP for the current session
+func (d *KvmHuaweiDriver) viewer() (string, error) {
+	req, _ := http.NewRequest("GET", "https://"+d.Host+"/bmc/pages/remote/kvm.jnlp", nil)
+	req.Header.Set("X-Auth-Token", d.token)
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("couldn't fetch jnlp (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't fetch jnlp (%s)", res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Contains(body, []byte("<jnlp")) {
+		return "", errors.New("iBMC did not return a jnlp")
+	}
+	return jnlp.Normalize(body)
+}
+
+// Close deletes the Redfish session
+func (d *KvmHuaweiDriver) Close() error {
+	if d.token == "" || d.location == "" {
+		d.token = ""
+		return nil
+	}
+	// Location may be an absolute URL or just the session path
+	path := d.location
+	if u, err := url.Parse(d.location); err == nil {
+		path = u.Path
+	}
+
+	res, err := d.request("DELETE", path, nil)
+	d.token = ""
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// GetHost return Configured driver Host
+func (d *KvmHuaweiDriver) GetHost() string {
+	return d.Host
+}
+
+// GetUsername return Configured driver Username
+func (d *KvmHuaweiDriver) GetUsername() string {
+	return d.Username
+}
+
+// GetPassword return Configured driver Password
+func (d *KvmHuaweiDriver) GetPassword() string {
+	return d.Password
+}
+
+// EOF
@@ -0,0 +1,76 @@
+// -*- go -*-
+
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/jre"
+)
+
+// runnerFeature is the oldest Java release the built-in runner takes,
+// argument files came with Java 9
+const runnerFeature = 9
+
+// selectRuntime returns the runtime pinned with javaHome, or the
+// oldest one of the runtimes found (searching javaPaths as well) of
+// feature release minFeature or later matching the j2se spec of the
+// viewer. It returns nil when there is no such runtime, the java and
+// javaws on the PATH are used then.
+func selectRuntime(javaHome string, javaPaths []string, spec string, minFeature int) *jre.Runtime {
+	if javaHome != "" {
+		runtime, err := jre.Load(javaHome)
+		if err != nil {
+			log.Printf("Ignoring java_home %s (%s)", javaHome, err)
+		} else {
+			log.Printf("Using pinned %s", runtime)
+			return runtime
+		}
+	}
+
+	runtimes := jre.Discover(javaPaths...)
+	if runtime := jre.Select(runtimes, spec, minFeature); runtime != nil {
+		log.Printf("Using %s for j2se %q", runtime, spec)
+		return runtime
+	}
+	if len(runtimes) == 0 {
+		log.Printf("No Java runtime found, using java from the PATH")
+		return nil
+	}
+	// runtimes are sorted newest first
+	if runtimes[0].Version.Feature < minFeature {
+		log.Printf("No Java %d or later runtime found, using java from the PATH", minFeature)
+		return nil
+	}
+	log.Printf("No Java runtime matches j2se %q, using %s", spec, runtimes[0])
+	return runtimes[0]
+}
+
+// javawsArgs returns the javaws options of runtime going before the
+// file, and whether javaws then runs until the viewer exits. Oracle
+// javaws from Java 7 and 8 only waits with -wait, later Web Start
+// implementations (IcedTea-Web, OpenWebStart) stay with -Xnofork and
+// want -jnlp before the file.
+func javawsArgs(runtime *jre.Runtime, wait bool) ([]string, bool) {
+	if runtime != nil && runtime.Version.Feature <= 8 {
+		if wait {
+			return []string{"-wait"}, true
+		}
+		return nil, false
+	}
+	return []string{"-nosecurity", "-noupdate", "-Xnofork", "-jnlp"}, true
+}
+
+// splitPaths splits a comma separated list of paths
+func splitPaths(s string) []string {
+	var paths []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// EOF
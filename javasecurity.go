@@ -0,0 +1,162 @@
+// -*- go -*-
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// securityProperties are the java.security algorithm restrictions the
+// legacy allowances lift entries of
+var securityProperties = []string{
+	"jdk.tls.disabledAlgorithms",
+	"jdk.certpath.disabledAlgorithms",
+	"jdk.jar.disabledAlgorithms",
+}
+
+// securityAllowances lists the restrictions lifted by each allowance,
+// restrictions mapped to an empty string are dropped
+var securityAllowances = map[kvm.Legacy]map[string]string{
+	kvm.LegacyTLS: {
+		"TLSv1":   "",
+		"TLSv1.1": "",
+	},
+	kvm.LegacyCiphers: {
+		"RC4":          "",
+		"3DES_EDE_CBC": "",
+	},
+	kvm.LegacyMD5Jars: {
+		"MD5":        "",
+		"MD5withRSA": "",
+		"SHA1 usage SignedJAR & denyAfter 2019-01-01": "",
+		"SHA1 denyAfter 2019-01-01":                   "",
+	},
+	kvm.LegacyWeakKeys: {
+		"RSA keySize < 1024": "RSA keySize < 512",
+		"DSA keySize < 1024": "DSA keySize < 512",
+		"DH keySize < 1024":  "DH keySize < 512",
+	},
+}
+
+// securityFile returns the java.security of the runtime binary java
+// (java or javaws) belongs to: conf/security since Java 9, lib/security
+// or jre/lib/security before
+func securityFile(java string) (string, error) {
+	binary, err := exec.LookPath(java)
+	if err != nil {
+		return "", err
+	}
+	if binary, err = filepath.EvalSymlinks(binary); err != nil {
+		return "", err
+	}
+
+	home := filepath.Dir(filepath.Dir(binary))
+	for _, dir := range []string{"conf", "lib", filepath.Join("jre", "lib")} {
+		filename := filepath.Join(home, dir, "security", "java.security")
+		if _, err := os.Stat(filename); err == nil {
+			return filename, nil
+		}
+	}
+	return "", fmt.Errorf("no java.security in %s", home)
+}
+
+// parseProperties reads a Java properties file, only the forms found
+// in java.security are handled: key=value, comments and continuations
+func parseProperties(data []byte) map[string]string {
+	properties := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	var line string
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if line == "" && (text == "" || text[0] == '#' || text[0] == '!') {
+			continue
+		}
+		if strings.HasSuffix(text, `\`) {
+			line += strings.TrimSuffix(text, `\`)
+			continue
+		}
+		line += text
+
+		if eq := strings.IndexAny(line, "=:"); eq > 0 {
+			properties[strings.TrimSpace(line[:eq])] = strings.TrimSpace(line[eq+1:])
+		}
+		line = ""
+	}
+	return properties
+}
+
+// javaSecurity returns the java.security properties lifting the
+// restrictions legacy allows from those of the runtime, given as read
+// from its java.security. Only the entries allowed are removed, only
+// the changed properties are given.
+func javaSecurity(legacy kvm.Legacy, runtime map[string]string) string {
+	var b strings.Builder
+	b.WriteString("# drac-kvm legacy allowances: " + legacy.String() + "\n")
+
+	for _, name := range securityProperties {
+		current, ok := runtime[name]
+		if !ok {
+			continue
+		}
+
+		changed := false
+		var values []string
+		for _, value := range strings.Split(current, ",") {
+			// Entries are compared with their spaces collapsed
+			value = strings.Join(strings.Fields(value), " ")
+			for allowance, replacements := range securityAllowances {
+				if legacy&allowance == 0 {
+					continue
+				}
+				if replacement, ok := replacements[value]; ok {
+					value = replacement
+					changed = true
+				}
+			}
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+		if changed {
+			fmt.Fprintf(&b, "%s=%s\n", name, strings.Join(values, ", "))
+		}
+	}
+	return b.String()
+}
+
+// writeJavaSecurity writes the java.security properties for legacy,
+// based on those of the runtime of the java binary, into a new private
+// directory, the caller removes it once the viewer exits
+func writeJavaSecurity(legacy kvm.Legacy, java string) (dir string, filename string, err error) {
+	source, err := securityFile(java)
+	if err != nil {
+		return "", "", err
+	}
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return "", "", err
+	}
+
+	dir, err = ioutil.TempDir("", "drac-kvm")
+	if err != nil {
+		return "", "", err
+	}
+
+	filename = filepath.Join(dir, "java.security")
+	if err := ioutil.WriteFile(filename, []byte(javaSecurity(legacy, parseProperties(data))), 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return dir, filename, nil
+}
+
+// EOF
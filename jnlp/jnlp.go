@@ -0,0 +1,311 @@
+// -*- go -*-
+
+// Package jnlp reads Java Network Launching Protocol documents, the
+// viewer descriptors handed out by BMCs, and runs them without javaws.
+package jnlp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+// JNLP is a Java Network Launching Protocol document. Elements and
+// attributes without a field are kept in Extra and Attrs so that
+// documents survive Parse and Marshal unchanged.
+type JNLP struct {
+	XMLName         xml.Name         `xml:"jnlp"`
+	Spec            string           `xml:"spec,attr,omitempty"`
+	Codebase        string           `xml:"codebase,attr,omitempty"`
+	Href            string           `xml:"href,attr,omitempty"`
+	Attrs           []xml.Attr       `xml:",any,attr"`
+	Information     []Information    `xml:"information"`
+	Security        *Security        `xml:"security"`
+	Resources       []Resources      `xml:"resources"`
+	ApplicationDesc *ApplicationDesc `xml:"application-desc"`
+	AppletDesc      *AppletDesc      `xml:"applet-desc"`
+	Extra           []Element        `xml:",any"`
+}
+
+// Element is an element the model has no type for
+type Element struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+// Information describes the application
+type Information struct {
+	OS     string     `xml:"os,attr,omitempty"`
+	Attrs  []xml.Attr `xml:",any,attr"`
+	Title  string     `xml:"title"`
+	Vendor string     `xml:"vendor"`
+	Extra  []Element  `xml:",any"`
+}
+
+// Security holds the permissions requested by the application
+type Security struct {
+	AllPermissions *struct{} `xml:"all-permissions"`
+	Extra          []Element `xml:",any"`
+}
+
+// Resources lists what is needed on the platforms matching OS and Arch,
+// both are space separated lists and empty for every platform
+type Resources struct {
+	OS         string      `xml:"os,attr,omitempty"`
+	Arch       string      `xml:"arch,attr,omitempty"`
+	Attrs      []xml.Attr  `xml:",any,attr"`
+	J2SE       []J2SE      `xml:"j2se"`
+	Java       []J2SE      `xml:"java"`
+	Jars       []Jar       `xml:"jar"`
+	NativeLibs []NativeLib `xml:"nativelib"`
+	Properties []Property  `xml:"property"`
+	Extra      []Element   `xml:",any"`
+}
+
+// J2SE is a Java runtime the application runs on, <java> is the same
+// element in later JNLP versions
+type J2SE struct {
+	Version string `xml:"version,attr"`
+	Href    string `xml:"href,attr,omitempty"`
+	// JavaVMArgs are JVM options the application needs
+	JavaVMArgs string     `xml:"java-vm-args,attr,omitempty"`
+	Attrs      []xml.Attr `xml:",any,attr"`
+}
+
+// Jar is a jar file of the class path
+type Jar struct {
+	Href     string     `xml:"href,attr"`
+	Main     string     `xml:"main,attr,omitempty"`
+	Download string     `xml:"download,attr,omitempty"`
+	Attrs    []xml.Attr `xml:",any,attr"`
+}
+
+// NativeLib is a jar file holding native libraries
+type NativeLib struct {
+	Href     string     `xml:"href,attr"`
+	Download string     `xml:"download,attr,omitempty"`
+	Attrs    []xml.Attr `xml:",any,attr"`
+}
+
+// Property is a system property set for the application
+type Property struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// ApplicationDesc describes how to start an application
+type ApplicationDesc struct {
+	MainClass string     `xml:"main-class,attr,omitempty"`
+	Attrs     []xml.Attr `xml:",any,attr"`
+	Arguments []string   `xml:"argument"`
+}
+
+// AppletDesc describes how to start an applet
+type AppletDesc struct {
+	MainClass string     `xml:"main-class,attr"`
+	Name      string     `xml:"name,attr,omitempty"`
+	Width     string     `xml:"width,attr,omitempty"`
+	Height    string     `xml:"height,attr,omitempty"`
+	Attrs     []xml.Attr `xml:",any,attr"`
+	Params    []Param    `xml:"param"`
+}
+
+// Param is an applet parameter
+type Param struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// Parse decodes a JNLP document. Anything around the document is
+// ignored, such as the blank lines some BMC templates start with or
+// the HTML wrapping of the iLO template.
+func Parse(data []byte) (*JNLP, error) {
+	start := bytes.Index(data, []byte("<?xml"))
+	if start < 0 {
+		start = bytes.Index(data, []byte("<jnlp"))
+	}
+	end := bytes.LastIndex(data, []byte("</jnlp>"))
+	if start < 0 || end < start {
+		return nil, errors.New("invalid jnlp: no jnlp element")
+	}
+
+	var doc JNLP
+	decoder := xml.NewDecoder(bytes.NewReader(data[start : end+len("</jnlp>")]))
+	decoder.CharsetReader = charsetReader
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid jnlp: %v", err)
+	}
+	if doc.ApplicationDesc == nil && doc.AppletDesc == nil {
+		return nil, errors.New("invalid jnlp: no application-desc or applet-desc")
+	}
+	return &doc, nil
+}
+
+// Validate checks that the document can be launched: it needs a
+// codebase for its relative hrefs, a jar and something to run
+func (j *JNLP) Validate() error {
+	if j.ApplicationDesc == nil && j.AppletDesc == nil {
+		return errors.New("invalid jnlp: no application-desc or applet-desc")
+	}
+	if j.ApplicationDesc != nil && j.AppletDesc != nil {
+		return errors.New("invalid jnlp: both application-desc and applet-desc")
+	}
+	if j.AppletDesc != nil && j.AppletDesc.MainClass == "" {
+		return errors.New("invalid jnlp: applet-desc without main-class")
+	}
+	if j.Codebase != "" {
+		if u, err := url.Parse(j.Codebase); err != nil || !u.IsAbs() {
+			return fmt.Errorf("invalid jnlp: codebase %q is not an absolute URL", j.Codebase)
+		}
+	}
+
+	jars := 0
+	for _, r := range j.Resources {
+		for _, jar := range r.Jars {
+			if _, err := j.Resolve(jar.Href); err != nil {
+				return fmt.Errorf("invalid jnlp: %v", err)
+			}
+			jars++
+		}
+		for _, nativeLib := range r.NativeLibs {
+			if _, err := j.Resolve(nativeLib.Href); err != nil {
+				return fmt.Errorf("invalid jnlp: %v", err)
+			}
+		}
+	}
+	if jars == 0 {
+		return errors.New("invalid jnlp: no jar")
+	}
+	return nil
+}
+
+// Marshal validates the document and encodes it
+func (j *JNLP) Marshal() ([]byte, error) {
+	if err := j.Validate(); err != nil {
+		return nil, err
+	}
+	data, err := xml.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// Normalize parses, validates and encodes data again, so that a
+// document coming from a BMC is handed out well-formed
+func Normalize(data []byte) (string, error) {
+	doc, err := Parse(data)
+	if err != nil {
+		return "", err
+	}
+	out, err := doc.Marshal()
+	return string(out), err
+}
+
+// Escape escapes s for XML text and attribute values
+func Escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// charsetReader decodes the single byte charsets found in BMC
+// documents besides UTF-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252", "us-ascii":
+	default:
+		return nil, fmt.Errorf("unsupported charset %s", charset)
+	}
+
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return strings.NewReader(string(runes)), nil
+}
+
+// javaOS maps GOOS to the os.name prefixes Java reports
+var javaOS = map[string][]string{
+	"linux":   {"Linux"},
+	"windows": {"Windows"},
+	"darwin":  {"Mac OS X", "Mac"},
+}
+
+// javaArch maps GOARCH to the os.arch values Java reports
+var javaArch = map[string][]string{
+	"amd64": {"amd64", "x86_64"},
+	"386":   {"x86", "i386", "i686"},
+	"arm64": {"aarch64", "arm64"},
+	"arm":   {"arm"},
+}
+
+// matches reports whether one of the space separated names of attr
+// matches one of values, either as a prefix (os) or exactly (arch).
+// An empty attr matches every platform.
+func matches(attr string, values []string, prefix bool) bool {
+	if attr == "" {
+		return true
+	}
+	for _, name := range strings.Fields(attr) {
+		for _, value := range values {
+			if strings.EqualFold(value, name) || (prefix && strings.HasPrefix(value, name)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Select returns the resources for the goos/goarch platform merged
+// together, in document order
+func (j *JNLP) Select(goos string, goarch string) Resources {
+	var selected Resources
+	for _, r := range j.Resources {
+		if !matches(r.OS, javaOS[goos], true) || !matches(r.Arch, javaArch[goarch], false) {
+			continue
+		}
+		selected.J2SE = append(selected.J2SE, r.J2SE...)
+		selected.J2SE = append(selected.J2SE, r.Java...)
+		selected.Jars = append(selected.Jars, r.Jars...)
+		selected.NativeLibs = append(selected.NativeLibs, r.NativeLibs...)
+		selected.Properties = append(selected.Properties, r.Properties...)
+	}
+	return selected
+}
+
+// Resolve returns the absolute URL of href, relative hrefs are
+// relative to the codebase directory
+func (j *JNLP) Resolve(href string) (*url.URL, error) {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return nil, err
+	}
+	if ref.IsAbs() {
+		return ref, nil
+	}
+	if j.Codebase == "" {
+		return nil, fmt.Errorf("relative href %s without codebase", href)
+	}
+
+	base, err := url.Parse(j.Codebase)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	return base.ResolveReference(ref), nil
+}
+
+// EOF
@@ -0,0 +1,146 @@
+// -*- go -*-
+
+package jnlp
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDoc = `<jnlp spec="1.0+" codebase="https://bmc:443/software">
+  <resources>
+    <jar href="viewer.jar" main="true"/>
+  </resources>
+  <application-desc main-class="Viewer">
+    <argument>ip=bmc</argument>
+    <argument>passwd=a&amp;b</argument>
+  </application-desc>
+</jnlp>`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"plain", testDoc, true},
+		{"xml header", `<?xml version="1.0"?>` + "\n" + testDoc, true},
+		{"leading blank lines", "\n\n" + testDoc, true},
+		{"html wrapped", "<html><body><pre>" + testDoc + "</pre></body></html>", true},
+		{"latin1", `<?xml version="1.0" encoding="ISO-8859-1"?>` + testDoc, true},
+		{"no jnlp", "<html>login</html>", false},
+		{"truncated", testDoc[:len(testDoc)-20], false},
+		{"nothing to run", `<jnlp><resources><jar href="a.jar"/></resources></jnlp>`, false},
+	}
+	for _, tt := range tests {
+		doc, err := Parse([]byte(tt.data))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: Parse error %v", tt.name, err)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if passwd, _ := doc.Argument("passwd"); passwd != "a&b" {
+			t.Errorf("%s: passwd = %q, want %q", tt.name, passwd, "a&b")
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"valid", testDoc, true},
+		{"no jar", strings.Replace(testDoc, `<jar href="viewer.jar" main="true"/>`, "", 1), false},
+		{"relative codebase", strings.Replace(testDoc, "https://bmc:443/software", "software", 1), false},
+		{"relative href without codebase", strings.Replace(testDoc, ` codebase="https://bmc:443/software"`, "", 1), false},
+	}
+	for _, tt := range tests {
+		out, err := Normalize([]byte(tt.data))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: Normalize error %v", tt.name, err)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if !strings.HasPrefix(out, "<?xml") {
+			t.Errorf("%s: no XML header in %q", tt.name, out)
+		}
+		// A normalized document normalizes to itself
+		again, err := Normalize([]byte(out))
+		if err != nil || again != out {
+			t.Errorf("%s: Normalize is not stable (%v)\n%s\n%s", tt.name, err, out, again)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"secret", "secret"},
+		{`a&<b>"c'd`, "a&amp;&lt;b&gt;&#34;c&#39;d"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Escape(tt.in); got != tt.want {
+			t.Errorf("Escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		codebase, href, want string
+	}{
+		{"https://bmc:443/software", "viewer.jar", "https://bmc:443/software/viewer.jar"},
+		{"https://bmc:443/software/", "viewer.jar", "https://bmc:443/software/viewer.jar"},
+		{"https://bmc:443/software", "/lib/viewer.jar", "https://bmc:443/lib/viewer.jar"},
+		{"https://bmc:443/software", "https://other/viewer.jar", "https://other/viewer.jar"},
+		{"", "https://other/viewer.jar", "https://other/viewer.jar"},
+		{"", "viewer.jar", ""},
+	}
+	for _, tt := range tests {
+		doc := &JNLP{Codebase: tt.codebase}
+		u, err := doc.Resolve(tt.href)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("Resolve(%q) in %q = %s, want an error", tt.href, tt.codebase, u)
+			}
+			continue
+		}
+		if err != nil || u.String() != tt.want {
+			t.Errorf("Resolve(%q) in %q = %v (%v), want %s", tt.href, tt.codebase, u, err, tt.want)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	template := strings.Replace(testDoc, "passwd=a&amp;b", "passwd={{ .Password }}", 1)
+
+	for _, password := range []string{"secret", `a&<b>"c'd`, "]]>{{ .Password }}"} {
+		out, err := Execute(template, map[string]string{"Password": password})
+		if err != nil {
+			t.Errorf("Execute with %q: %v", password, err)
+			continue
+		}
+		doc, err := Parse([]byte(out))
+		if err != nil {
+			t.Errorf("Execute with %q: %v", password, err)
+			continue
+		}
+		if got, _ := doc.Argument("passwd"); got != password {
+			t.Errorf("Execute with %q: passwd = %q", password, got)
+		}
+	}
+
+	if _, err := Execute(template, map[string]string{}); err == nil {
+		t.Errorf("Execute without Password succeeded")
+	}
+}
+
+// EOF
@@ -0,0 +1,156 @@
+// -*- go -*-
+
+package jnlp
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// SetCodebase changes the codebase, relative hrefs follow it
+func (j *JNLP) SetCodebase(codebase string) {
+	j.Codebase = codebase
+}
+
+// RewriteHrefs replaces the href of every jar and nativelib with the
+// result of f
+func (j *JNLP) RewriteHrefs(f func(href string) string) {
+	for i := range j.Resources {
+		r := &j.Resources[i]
+		for k := range r.Jars {
+			r.Jars[k].Href = f(r.Jars[k].Href)
+		}
+		for k := range r.NativeLibs {
+			r.NativeLibs[k].Href = f(r.NativeLibs[k].Href)
+		}
+	}
+}
+
+// rewriteURL applies f to the host and port of s when it is an
+// absolute URL
+func rewriteURL(s string, f func(host string, port string) (string, string)) string {
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return s
+	}
+	host, port := u.Hostname(), u.Port()
+	host, port = f(host, port)
+	if port == "" {
+		u.Host = host
+		if strings.Contains(host, ":") {
+			u.Host = "[" + host + "]"
+		}
+	} else {
+		u.Host = net.JoinHostPort(host, port)
+	}
+	return u.String()
+}
+
+// rewriteValues applies f to the codebase, hrefs, arguments and applet
+// parameters. Arguments are either plain values or name=value pairs,
+// f gets the name (empty for plain values) and the value.
+func (j *JNLP) rewriteValues(f func(name string, value string) string) {
+	j.Codebase = f("", j.Codebase)
+	j.RewriteHrefs(func(href string) string { return f("", href) })
+
+	if j.ApplicationDesc != nil {
+		for i, arg := range j.ApplicationDesc.Arguments {
+			if eq := strings.Index(arg, "="); eq > 0 {
+				j.ApplicationDesc.Arguments[i] = arg[:eq+1] + f(arg[:eq], arg[eq+1:])
+			} else {
+				j.ApplicationDesc.Arguments[i] = f("", arg)
+			}
+		}
+	}
+	if j.AppletDesc != nil {
+		for i, param := range j.AppletDesc.Params {
+			j.AppletDesc.Params[i].Value = f(param.Name, param.Value)
+		}
+	}
+}
+
+// RewriteHost points every reference to the host from at the host to:
+// URLs of the codebase, hrefs, arguments and applet parameters as well
+// as arguments and parameters which are just the host. BMCs often
+// refer to themselves by an address not reachable from here.
+func (j *JNLP) RewriteHost(from string, to string) {
+	if from == "" || from == to {
+		return
+	}
+	j.rewriteValues(func(name string, value string) string {
+		if value == from {
+			return to
+		}
+		return rewriteURL(value, func(host string, port string) (string, string) {
+			if host == from {
+				host = to
+			}
+			return host, port
+		})
+	})
+}
+
+// RewritePort replaces the port from by the port to in URLs and in
+// arguments and parameters named like a port (kmport=5900, vport...)
+func (j *JNLP) RewritePort(from string, to string) {
+	if from == "" || from == to {
+		return
+	}
+	j.rewriteValues(func(name string, value string) string {
+		if value == from && strings.Contains(strings.ToLower(name), "port") {
+			return to
+		}
+		return rewriteURL(value, func(host string, port string) (string, string) {
+			if port == from {
+				port = to
+			}
+			return host, port
+		})
+	})
+}
+
+// Argument returns the value of the name=value argument, or of the
+// applet parameter name
+func (j *JNLP) Argument(name string) (string, bool) {
+	if j.ApplicationDesc != nil {
+		for _, arg := range j.ApplicationDesc.Arguments {
+			if strings.HasPrefix(arg, name+"=") {
+				return arg[len(name)+1:], true
+			}
+		}
+	}
+	if j.AppletDesc != nil {
+		for _, param := range j.AppletDesc.Params {
+			if param.Name == name {
+				return param.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// SetArgument sets the name=value argument, or the applet parameter
+// name, adding it when missing
+func (j *JNLP) SetArgument(name string, value string) {
+	if j.ApplicationDesc != nil {
+		for i, arg := range j.ApplicationDesc.Arguments {
+			if strings.HasPrefix(arg, name+"=") {
+				j.ApplicationDesc.Arguments[i] = name + "=" + value
+				return
+			}
+		}
+		j.ApplicationDesc.Arguments = append(j.ApplicationDesc.Arguments, name+"="+value)
+	}
+	if j.AppletDesc != nil {
+		for i, param := range j.AppletDesc.Params {
+			if param.Name == name {
+				j.AppletDesc.Params[i].Value = value
+				return
+			}
+		}
+		j.AppletDesc.Params = append(j.AppletDesc.Params, Param{Name: name, Value: value})
+	}
+}
+
+// EOF
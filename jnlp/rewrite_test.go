@@ -0,0 +1,132 @@
+// -*- go -*-
+
+package jnlp
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testJNLP returns a document referring to its host in every place
+// RewriteHost and RewritePort look at
+func testJNLP() *JNLP {
+	return &JNLP{
+		Codebase: "https://10.0.0.1:443/",
+		Resources: []Resources{{
+			Jars:       []Jar{{Href: "https://10.0.0.1:443/viewer.jar"}},
+			NativeLibs: []NativeLib{{Href: "lib/native.jar"}},
+		}},
+		ApplicationDesc: &ApplicationDesc{
+			Arguments: []string{"ip=10.0.0.1", "kmport=5900", "10.0.0.1", "5900", "title=10.0.0.10"},
+		},
+	}
+}
+
+func TestRewriteHost(t *testing.T) {
+	tests := []struct {
+		from, to string
+		codebase string
+		jar      string
+		args     []string
+	}{
+		{"10.0.0.1", "bmc.example.com", "https://bmc.example.com:443/", "https://bmc.example.com:443/viewer.jar",
+			[]string{"ip=bmc.example.com", "kmport=5900", "bmc.example.com", "5900", "title=10.0.0.10"}},
+		{"10.0.0.1", "fe80::1", "https://[fe80::1]:443/", "https://[fe80::1]:443/viewer.jar",
+			[]string{"ip=fe80::1", "kmport=5900", "fe80::1", "5900", "title=10.0.0.10"}},
+		{"10.0.0.2", "bmc.example.com", "https://10.0.0.1:443/", "https://10.0.0.1:443/viewer.jar",
+			[]string{"ip=10.0.0.1", "kmport=5900", "10.0.0.1", "5900", "title=10.0.0.10"}},
+	}
+	for _, tt := range tests {
+		doc := testJNLP()
+		doc.RewriteHost(tt.from, tt.to)
+		if doc.Codebase != tt.codebase {
+			t.Errorf("RewriteHost(%q, %q) codebase = %q, want %q", tt.from, tt.to, doc.Codebase, tt.codebase)
+		}
+		if href := doc.Resources[0].Jars[0].Href; href != tt.jar {
+			t.Errorf("RewriteHost(%q, %q) jar = %q, want %q", tt.from, tt.to, href, tt.jar)
+		}
+		if href := doc.Resources[0].NativeLibs[0].Href; href != "lib/native.jar" {
+			t.Errorf("RewriteHost(%q, %q) changed relative href to %q", tt.from, tt.to, href)
+		}
+		if args := doc.ApplicationDesc.Arguments; !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("RewriteHost(%q, %q) arguments = %q, want %q", tt.from, tt.to, args, tt.args)
+		}
+	}
+}
+
+func TestRewritePort(t *testing.T) {
+	tests := []struct {
+		from, to string
+		codebase string
+		args     []string
+	}{
+		{"443", "8443", "https://10.0.0.1:8443/",
+			[]string{"ip=10.0.0.1", "kmport=5900", "10.0.0.1", "5900", "title=10.0.0.10"}},
+		// Only arguments named like a port change, not plain ones
+		{"5900", "15900", "https://10.0.0.1:443/",
+			[]string{"ip=10.0.0.1", "kmport=15900", "10.0.0.1", "5900", "title=10.0.0.10"}},
+	}
+	for _, tt := range tests {
+		doc := testJNLP()
+		doc.RewritePort(tt.from, tt.to)
+		if doc.Codebase != tt.codebase {
+			t.Errorf("RewritePort(%q, %q) codebase = %q, want %q", tt.from, tt.to, doc.Codebase, tt.codebase)
+		}
+		if args := doc.ApplicationDesc.Arguments; !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("RewritePort(%q, %q) arguments = %q, want %q", tt.from, tt.to, args, tt.args)
+		}
+	}
+}
+
+func TestArgument(t *testing.T) {
+	applet := &JNLP{AppletDesc: &AppletDesc{Params: []Param{{Name: "IPA", Value: "10.0.0.1"}}}}
+
+	tests := []struct {
+		doc   *JNLP
+		name  string
+		value string
+		ok    bool
+	}{
+		{testJNLP(), "ip", "10.0.0.1", true},
+		{testJNLP(), "kmport", "5900", true},
+		{testJNLP(), "passwd", "", false},
+		{applet, "IPA", "10.0.0.1", true},
+		{applet, "IPB", "", false},
+	}
+	for _, tt := range tests {
+		value, ok := tt.doc.Argument(tt.name)
+		if value != tt.value || ok != tt.ok {
+			t.Errorf("Argument(%q) = %q, %v, want %q, %v", tt.name, value, ok, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestSetArgument(t *testing.T) {
+	tests := []struct {
+		name, value string
+		args        []string
+	}{
+		{"kmport", "15900", []string{"ip=10.0.0.1", "kmport=15900", "10.0.0.1", "5900", "title=10.0.0.10"}},
+		{"passwd", "a=b", []string{"ip=10.0.0.1", "kmport=5900", "10.0.0.1", "5900", "title=10.0.0.10", "passwd=a=b"}},
+	}
+	for _, tt := range tests {
+		doc := testJNLP()
+		doc.SetArgument(tt.name, tt.value)
+		if args := doc.ApplicationDesc.Arguments; !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("SetArgument(%q, %q) arguments = %q, want %q", tt.name, tt.value, args, tt.args)
+		}
+		if value, _ := doc.Argument(tt.name); value != tt.value {
+			t.Errorf("SetArgument(%q, %q) then Argument = %q", tt.name, tt.value, value)
+		}
+	}
+
+	applet := &JNLP{AppletDesc: &AppletDesc{Params: []Param{{Name: "IPA", Value: "10.0.0.1"}}}}
+	applet.SetArgument("IPA", "bmc")
+	applet.SetArgument("PORT", "23")
+	want := []Param{{Name: "IPA", Value: "bmc"}, {Name: "PORT", Value: "23"}}
+	if !reflect.DeepEqual(applet.AppletDesc.Params, want) {
+		t.Errorf("SetArgument on applet params = %v, want %v", applet.AppletDesc.Params, want)
+	}
+}
+
+// EOF
@@ -0,0 +1,283 @@
+// -*- go -*-
+
+package jnlp
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Runner runs the application of a JNLP document with a plain java
+// binary, doing the work of javaws which recent Java releases lack
+type Runner struct {
+	// Java is the java binary, java from the PATH when empty
+	Java string
+	// JavaArgs are JVM options given before those of the JNLP
+	JavaArgs []string
+	// LegacyArgs tells the runtime is Java 8 or older, which has no
+	// argument files. The viewer arguments would show up in the
+	// process list, such runtimes are refused.
+	LegacyArgs bool
+	// Client downloads the jars, http.DefaultClient when nil
+	Client *http.Client
+	// Stdout and Stderr of the application, os.Stdout and os.Stderr
+	// when nil
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Run downloads the resources of doc into a private temporary
+// directory and runs the application until it exits
+func (r *Runner) Run(doc *JNLP) error {
+	dir, err := ioutil.TempDir("", "drac-kvm")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	cmd, err := r.Command(doc, dir)
+	if err != nil {
+		return err
+	}
+	return cmd.Run()
+}
+
+// Command prepares dir and returns the java command running the
+// application of doc. The class path, main class and arguments are
+// written to an argument file (java @file, Java 9 and later) so that
+// credentials passed as arguments do not show up in the process list.
+func (r *Runner) Command(doc *JNLP, dir string) (*exec.Cmd, error) {
+	if doc.ApplicationDesc == nil {
+		return nil, errors.New("applets can't be run without javaws")
+	}
+	if r.LegacyArgs {
+		return nil, errors.New("java 8 and older have no argument files, the viewer credentials would show in the process list (use javaws or Java 9 and later)")
+	}
+
+	lib := filepath.Join(dir, "lib")
+	native := filepath.Join(dir, "native")
+	for _, d := range []string{lib, native} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	resources := doc.Select(runtime.GOOS, runtime.GOARCH)
+
+	// The main jar goes first on the class path
+	var jars []Jar
+	for _, jar := range resources.Jars {
+		if jar.Main == "true" {
+			jars = append([]Jar{jar}, jars...)
+		} else {
+			jars = append(jars, jar)
+		}
+	}
+
+	var classPath []string
+	for _, jar := range jars {
+		filename, err := r.download(doc, jar.Href, lib)
+		if err != nil {
+			return nil, err
+		}
+		classPath = append(classPath, filename)
+	}
+	if len(classPath) == 0 {
+		return nil, fmt.Errorf("no jar for %s/%s in jnlp", runtime.GOOS, runtime.GOARCH)
+	}
+
+	for _, nativeLib := range resources.NativeLibs {
+		filename, err := r.download(doc, nativeLib.Href, lib)
+		if err != nil {
+			return nil, err
+		}
+		if err := extractNativeLibs(filename, native); err != nil {
+			return nil, fmt.Errorf("couldn't extract %s (%v)", nativeLib.Href, err)
+		}
+	}
+
+	mainClass := doc.ApplicationDesc.MainClass
+	if mainClass == "" {
+		var err error
+		if mainClass, err = manifestMainClass(classPath[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	args := append([]string{}, r.JavaArgs...)
+	// javaws runs the first j2se the runtime matches, we don't know
+	// which one that is and use the first
+	if len(resources.J2SE) > 0 {
+		args = append(args, strings.Fields(resources.J2SE[0].JavaVMArgs)...)
+	}
+	args = append(args, "-Djava.library.path="+native)
+	for _, property := range resources.Properties {
+		args = append(args, "-D"+property.Name+"="+property.Value)
+	}
+	args = append(args, "-cp", strings.Join(classPath, string(os.PathListSeparator)), mainClass)
+	args = append(args, doc.ApplicationDesc.Arguments...)
+
+	java := r.Java
+	if java == "" {
+		java = "java"
+	}
+
+	argFile := filepath.Join(dir, "args")
+	if err := writeArgFile(argFile, args); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(java, "@"+argFile)
+	cmd.Dir = dir
+	cmd.Stdout = r.Stdout
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	cmd.Stderr = r.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	return cmd, nil
+}
+
+// download fetches href relative to the codebase of doc into dir
+func (r *Runner) download(doc *JNLP, href string, dir string) (string, error) {
+	u, err := doc.Resolve(href)
+	if err != nil {
+		return "", err
+	}
+	// Jars already on disk, e.g. from the jar cache, are used in place
+	if u.Scheme == "file" {
+		return localPath(u), nil
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Get(u.String())
+	if err != nil {
+		return "", fmt.Errorf("couldn't download %s (%v)", u, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't download %s (%s)", u, res.Status)
+	}
+
+	// Resources of different paths may share their base name
+	sum := sha256.Sum256([]byte(u.String()))
+	filename := filepath.Join(dir, hex.EncodeToString(sum[:8])+"-"+path.Base(u.Path))
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, res.Body); err != nil {
+		f.Close()
+		return "", fmt.Errorf("couldn't download %s (%v)", u, err)
+	}
+	return filename, f.Close()
+}
+
+// localPath returns the file name of a file URL
+func localPath(u *url.URL) string {
+	p := u.Path
+	// Windows paths start with the drive letter, /C:/...
+	if runtime.GOOS == "windows" {
+		p = strings.TrimPrefix(p, "/")
+	}
+	return filepath.FromSlash(p)
+}
+
+// extractNativeLibs extracts the libraries at the top of a nativelib
+// jar into dir
+func extractNativeLibs(jar string, dir string) error {
+	z, err := zip.OpenReader(jar)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	for _, file := range z.File {
+		if file.FileInfo().IsDir() || strings.HasPrefix(file.Name, "META-INF/") {
+			continue
+		}
+		if err := extractFile(file, filepath.Join(dir, path.Base(file.Name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFile writes a zip file entry to filename
+func extractFile(file *zip.File, filename string) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0700)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// manifestMainClass reads the Main-Class of a jar manifest
+func manifestMainClass(jar string) (string, error) {
+	z, err := zip.OpenReader(jar)
+	if err != nil {
+		return "", err
+	}
+	defer z.Close()
+
+	for _, file := range z.File {
+		if file.Name != "META-INF/MANIFEST.MF" {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+
+		scanner := bufio.NewScanner(rc)
+		for scanner.Scan() {
+			if value := strings.TrimPrefix(scanner.Text(), "Main-Class:"); value != scanner.Text() {
+				return strings.TrimSpace(value), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no main class in jnlp or %s", filepath.Base(jar))
+}
+
+// writeArgFile writes args to a private java argument file, each
+// quoted so that spaces and backslashes survive
+func writeArgFile(filename string, args []string) error {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+
+	var b strings.Builder
+	for _, arg := range args {
+		b.WriteString(`"` + r.Replace(arg) + `"` + "\n")
+	}
+	return ioutil.WriteFile(filename, []byte(b.String()), 0600)
+}
+
+// EOF
@@ -0,0 +1,117 @@
+// -*- go -*-
+
+package jnlp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Server hands out a JNLP document exactly once over HTTP on the
+// loopback interface, so that it never has to be written to disk
+type Server struct {
+	// URL is where the document is served, its path is a random token
+	URL string
+
+	data    []byte
+	path    string
+	server  *http.Server
+	mu      sync.Mutex
+	fetched chan struct{}
+	done    chan struct{}
+	ok      bool
+}
+
+// Serve starts serving doc on an ephemeral 127.0.0.1 port, the
+// listener is shut down after the first fetch or after timeout. The
+// href of the document is dropped, javaws would fetch it again from
+// there.
+func Serve(doc *JNLP, timeout time.Duration) (*Server, error) {
+	served := *doc
+	served.Href = ""
+	data, err := served.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		data:    data,
+		path:    "/" + hex.EncodeToString(token) + "/viewer.jnlp",
+		fetched: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	s.URL = "http://" + l.Addr().String() + s.path
+	s.server = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go s.server.Serve(l)
+
+	go func() {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		select {
+		case <-s.fetched:
+			s.ok = true
+		case <-t.C:
+		}
+		s.Close()
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// ServeHTTP answers the first GET of the token path with the document
+// and everything else with 404
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" || r.URL.Path != s.path {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	data := s.data
+	s.data = nil
+	s.mu.Unlock()
+	if data == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-java-jnlp-file")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+	close(s.fetched)
+}
+
+// Wait waits for the listener to shut down and reports whether the
+// document was fetched
+func (s *Server) Wait() bool {
+	<-s.done
+	return s.ok
+}
+
+// Close stops the listener early, letting a response in flight finish
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.data = nil
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// EOF
@@ -0,0 +1,30 @@
+// -*- go -*-
+
+package jnlp
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// Execute fills out a JNLP template with values escaped for XML, so a
+// password like a&<b can't break the document, and returns the result
+// normalized
+func Execute(text string, values map[string]string) (string, error) {
+	tmpl, err := template.New("jnlp").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	escaped := make(map[string]string, len(values))
+	for k, v := range values {
+		escaped[k] = Escape(v)
+	}
+	var buff bytes.Buffer
+	if err := tmpl.Execute(&buff, escaped); err != nil {
+		return "", err
+	}
+	return Normalize(buff.Bytes())
+}
+
+// EOF
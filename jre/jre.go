@@ -0,0 +1,167 @@
+// -*- go -*-
+
+// Package jre finds the Java runtimes installed on the system and picks
+// the one matching the requirements of a viewer.
+package jre
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Runtime is an installed Java runtime
+type Runtime struct {
+	// Home is the JAVA_HOME of the runtime
+	Home    string
+	Version Version
+	// Java is the java binary
+	Java string
+	// Javaws is the javaws binary, empty when the runtime has none
+	Javaws string
+}
+
+func (r *Runtime) String() string {
+	return fmt.Sprintf("Java %s (%s)", r.Version, r.Home)
+}
+
+// exe returns the name of a binary of the runtime
+func exe(home string, name string) string {
+	filename := filepath.Join(home, "bin", name)
+	if _, err := os.Stat(filename + ".exe"); err == nil {
+		return filename + ".exe"
+	}
+	return filename
+}
+
+// javaVersionRe finds the version in `java -version` output and in
+// the release file of a runtime
+var javaVersionRe = regexp.MustCompile(`(?:version|JAVA_VERSION=)\s*"([^"]+)"`)
+
+// Load returns the runtime installed in home
+func Load(home string) (*Runtime, error) {
+	runtime := &Runtime{Home: home, Java: exe(home, "java")}
+	if _, err := os.Stat(runtime.Java); err != nil {
+		return nil, fmt.Errorf("no java runtime in %s", home)
+	}
+	if javaws := exe(home, "javaws"); fileExists(javaws) {
+		runtime.Javaws = javaws
+	}
+
+	version, err := releaseVersion(home)
+	if err != nil {
+		// Old runtimes have no release file, ask java itself
+		if version, err = JavaVersion(runtime.Java); err != nil {
+			return nil, err
+		}
+	}
+	runtime.Version = version
+	return runtime, nil
+}
+
+// releaseVersion reads the version from the release file of home
+func releaseVersion(home string) (Version, error) {
+	f, err := os.Open(filepath.Join(home, "release"))
+	if err != nil {
+		return Version{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if m := javaVersionRe.FindStringSubmatch(scanner.Text()); m != nil && strings.HasPrefix(scanner.Text(), "JAVA_VERSION=") {
+			return ParseVersion(m[1])
+		}
+	}
+	return Version{}, errors.New("no JAVA_VERSION in release file")
+}
+
+// JavaVersion returns the version of a java binary by running
+// java -version, which writes to stderr
+func JavaVersion(java string) (Version, error) {
+	out, err := exec.Command(java, "-version").CombinedOutput()
+	if err != nil {
+		return Version{}, fmt.Errorf("couldn't run %s -version (%v)", java, err)
+	}
+	m := javaVersionRe.FindSubmatch(out)
+	if m == nil {
+		return Version{}, fmt.Errorf("no version in %s -version output", java)
+	}
+	return ParseVersion(string(m[1]))
+}
+
+// Discover returns the runtimes found in the homes given, JAVA_HOME,
+// the java on the PATH, SDKMAN and the usual system locations, newest
+// first
+func Discover(homes ...string) []*Runtime {
+	candidates := append([]string{}, homes...)
+	if home := os.Getenv("JAVA_HOME"); home != "" {
+		candidates = append(candidates, home)
+	}
+	if java, err := exec.LookPath("java"); err == nil {
+		if java, err = filepath.EvalSymlinks(java); err == nil {
+			candidates = append(candidates, filepath.Dir(filepath.Dir(java)))
+		}
+	}
+
+	sdkman := os.Getenv("SDKMAN_DIR")
+	if sdkman == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			sdkman = filepath.Join(home, ".sdkman")
+		}
+	}
+	patterns := append([]string{filepath.Join(sdkman, "candidates", "java", "*")}, systemPatterns...)
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		candidates = append(candidates, matches...)
+	}
+
+	seen := make(map[string]bool)
+	var runtimes []*Runtime
+	for _, home := range candidates {
+		real, err := filepath.EvalSymlinks(home)
+		if err != nil || seen[real] {
+			continue
+		}
+		seen[real] = true
+
+		if runtime, err := Load(home); err == nil {
+			runtimes = append(runtimes, runtime)
+		}
+	}
+
+	sort.SliceStable(runtimes, func(i, j int) bool {
+		return runtimes[i].Version.Compare(runtimes[j].Version) > 0
+	})
+	return runtimes
+}
+
+// Select returns the oldest runtime of feature release minFeature or
+// later matching the j2se version spec of a viewer, old viewers work
+// best on the runtime they were made for, but the launcher may need a
+// newer one. It returns nil when no runtime matches.
+func Select(runtimes []*Runtime, spec string, minFeature int) *Runtime {
+	var selected *Runtime
+	for _, runtime := range runtimes {
+		if runtime.Version.Feature >= minFeature && runtime.Version.Matches(spec) {
+			if selected == nil || runtime.Version.Compare(selected.Version) < 0 {
+				selected = runtime
+			}
+		}
+	}
+	return selected
+}
+
+// fileExists reports whether filename exists and is not a directory
+func fileExists(filename string) bool {
+	info, err := os.Stat(filename)
+	return err == nil && !info.IsDir()
+}
+
+// EOF
@@ -0,0 +1,40 @@
+// -*- go -*-
+
+package jre
+
+import (
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	var runtimes []*Runtime
+	for _, v := range []string{"17.0.2", "11.0.12", "1.8.0_292", "1.7.0_80"} {
+		version, _ := ParseVersion(v)
+		runtimes = append(runtimes, &Runtime{Home: v, Version: version})
+	}
+
+	tests := []struct {
+		spec       string
+		minFeature int
+		want       string
+	}{
+		{"1.7+", 0, "1.7.0_80"},
+		{"1.8+", 0, "1.8.0_292"},
+		{"1.7+", 9, "11.0.12"},
+		{"1.8", 0, "1.8.0_292"},
+		{"1.8", 9, ""},
+		{"1.6", 0, ""},
+		{"", 17, "17.0.2"},
+	}
+	for _, tt := range tests {
+		got := ""
+		if runtime := Select(runtimes, tt.spec, tt.minFeature); runtime != nil {
+			got = runtime.Home
+		}
+		if got != tt.want {
+			t.Errorf("Select(%q, %d) = %q, want %q", tt.spec, tt.minFeature, got, tt.want)
+		}
+	}
+}
+
+// EOF
@@ -0,0 +1,13 @@
+// -*- go -*-
+
+package jre
+
+// systemPatterns are where runtimes are installed on macOS
+var systemPatterns = []string{
+	"/Library/Java/JavaVirtualMachines/*/Contents/Home",
+	"/Library/Internet Plug-Ins/JavaAppletPlugin.plugin/Contents/Home",
+	"/opt/homebrew/opt/openjdk*/libexec/openjdk.jdk/Contents/Home",
+	"/usr/local/opt/openjdk*/libexec/openjdk.jdk/Contents/Home",
+}
+
+// EOF
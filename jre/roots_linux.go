@@ -0,0 +1,13 @@
+// -*- go -*-
+
+package jre
+
+// systemPatterns are where Linux distributions install runtimes
+var systemPatterns = []string{
+	"/usr/lib/jvm/*",
+	"/usr/java/*",
+	"/opt/java/*",
+	"/opt/jdk*",
+}
+
+// EOF
@@ -0,0 +1,16 @@
+// -*- go -*-
+
+package jre
+
+// systemPatterns are where runtimes are installed on Windows, one level
+// below the vendor directories
+var systemPatterns = []string{
+	`C:\Program Files\Java\*`,
+	`C:\Program Files (x86)\Java\*`,
+	`C:\Program Files\Eclipse Adoptium\*`,
+	`C:\Program Files\Zulu\*`,
+	`C:\Program Files\Microsoft\*`,
+	`C:\Program Files\Amazon Corretto\*`,
+}
+
+// EOF
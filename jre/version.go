@@ -0,0 +1,102 @@
+// -*- go -*-
+
+package jre
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a Java version with the legacy 1.x numbering folded,
+// 1.8.0_292 is {8, 0, 292} just like 11.0.12 is {11, 0, 12}
+type Version struct {
+	Feature int
+	Interim int
+	Update  int
+}
+
+// versionRe splits a version string into its numbers
+var versionRe = regexp.MustCompile(`^(\d+)(?:[._](\d+))?(?:[._](\d+))?(?:[._](\d+))?`)
+
+// ParseVersion parses the versions reported by Java runtimes, such as
+// 1.8.0_292, 11.0.12, 17 or 21-ea
+func ParseVersion(s string) (Version, error) {
+	m := versionRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Version{}, fmt.Errorf("invalid Java version %q", s)
+	}
+
+	var numbers []int
+	for _, n := range m[1:] {
+		if n == "" {
+			break
+		}
+		i, _ := strconv.Atoi(n)
+		numbers = append(numbers, i)
+	}
+	// 1.8.0_292 is Java 8 update 292
+	if numbers[0] == 1 && len(numbers) > 1 {
+		numbers = numbers[1:]
+	}
+	for len(numbers) < 3 {
+		numbers = append(numbers, 0)
+	}
+	return Version{Feature: numbers[0], Interim: numbers[1], Update: numbers[2]}, nil
+}
+
+// Compare returns -1, 0 or 1 when v is older, the same or newer than w
+func (v Version) Compare(w Version) int {
+	a := []int{v.Feature, v.Interim, v.Update}
+	b := []int{w.Feature, w.Interim, w.Update}
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Feature, v.Interim, v.Update)
+}
+
+// Matches reports whether v satisfies the version attribute of a JNLP
+// <j2se> element, a space separated list of versions where "1.7+"
+// means 1.7 or later, and "1.7" or "1.7*" any 1.7 release
+func (v Version) Matches(spec string) bool {
+	if strings.TrimSpace(spec) == "" {
+		return true
+	}
+
+	for _, id := range strings.Fields(spec) {
+		orLater := strings.HasSuffix(id, "+")
+		id = strings.TrimRight(id, "+*")
+
+		want, err := ParseVersion(id)
+		if err != nil {
+			continue
+		}
+		if orLater {
+			if v.Compare(want) >= 0 {
+				return true
+			}
+			continue
+		}
+
+		// Only the numbers given have to match, 1.7 matches 1.7.0_80
+		given := strings.Count(strings.TrimPrefix(id, "1."), ".") + strings.Count(id, "_") + 1
+		if v.Feature == want.Feature &&
+			(given < 2 || v.Interim == want.Interim) &&
+			(given < 3 || v.Update == want.Update) {
+			return true
+		}
+	}
+	return false
+}
+
+// EOF
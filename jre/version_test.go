@@ -0,0 +1,70 @@
+// -*- go -*-
+
+package jre
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Version
+		ok   bool
+	}{
+		{"1.8.0_292", Version{8, 0, 292}, true},
+		{"1.7.0_80", Version{7, 0, 80}, true},
+		{"1.6", Version{6, 0, 0}, true},
+		{"11.0.12", Version{11, 0, 12}, true},
+		{"17", Version{17, 0, 0}, true},
+		{"21-ea", Version{21, 0, 0}, true},
+		{" 17.0.2\n", Version{17, 0, 2}, true},
+		{"", Version{}, false},
+		{"openjdk", Version{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseVersion(%q) error %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseVersion(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		version string
+		spec    string
+		want    bool
+	}{
+		{"1.8.0_292", "", true},
+		{"1.8.0_292", "1.6+", true},
+		{"1.8.0_292", "1.8+", true},
+		{"1.8.0_292", "1.9+", false},
+		{"11.0.12", "1.8+", true},
+		{"1.7.0_80", "1.7", true},
+		{"1.7.0_80", "1.7*", true},
+		{"1.8.0_292", "1.7", false},
+		{"1.7.0_80", "1.7.0_80", true},
+		{"1.7.0_79", "1.7.0_80", false},
+		{"11.0.12", "11", true},
+		{"17.0.2", "11", false},
+		{"1.8.0_292", "1.6 1.8", true},
+		{"1.8.0_292", "bogus 1.8", true},
+		{"1.8.0_292", "bogus", false},
+	}
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := v.Matches(tt.spec); got != tt.want {
+			t.Errorf("%s Matches(%q) = %v, want %v", tt.version, tt.spec, got, tt.want)
+		}
+	}
+}
+
+// EOF
@@ -0,0 +1,98 @@
+// -*- go -*-
+
+package kvm
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+)
+
+// FirmwareDriver is implemented by drivers knowing the firmware of
+// their BMC, viewer jars are cached per firmware so that an upgrade
+// brings the matching viewer
+type FirmwareDriver interface {
+	Firmware() string
+}
+
+// firmware returns the cache key of the driver's firmware
+func (d *KVM) firmware() string {
+	if driver, ok := d.Driver.(FirmwareDriver); ok {
+		if firmware := driver.Firmware(); firmware != "" {
+			return firmware
+		}
+	}
+	return "unknown"
+}
+
+// cacheViewer points the jars of viewer at their copies in the jar
+// cache, fetching them as needed. The viewer is returned unchanged
+// when anything goes wrong, except in offline mode where the jars
+// can't be had from anywhere else.
+func (d *KVM) cacheViewer(viewer string) (string, error) {
+	// fail gives up on caching, which only offline mode can't do
+	fail := func(err error) (string, error) {
+		if d.Config.Cache.Offline {
+			return "", fmt.Errorf("viewer jars unavailable offline (%v)", err)
+		}
+		log.Printf("Unable to cache viewer jars (%s)", err)
+		return viewer, nil
+	}
+
+	doc, err := jnlp.Parse([]byte(viewer))
+	if err != nil {
+		return fail(err)
+	}
+
+	resources := doc.Select(runtime.GOOS, runtime.GOARCH)
+	hrefs := make([]string, 0, len(resources.Jars)+len(resources.NativeLibs))
+	for _, jar := range resources.Jars {
+		hrefs = append(hrefs, jar.Href)
+	}
+	for _, nativeLib := range resources.NativeLibs {
+		hrefs = append(hrefs, nativeLib.Href)
+	}
+
+	firmware := d.firmware()
+	cached := make(map[string]string, len(hrefs))
+	for _, href := range hrefs {
+		u, err := doc.Resolve(href)
+		if err != nil {
+			return fail(err)
+		}
+		filename, err := d.Config.Cache.Fetch(d.Vendor, firmware, u.String())
+		if err != nil {
+			return fail(err)
+		}
+		cached[href] = fileURL(filename)
+	}
+
+	doc.RewriteHrefs(func(href string) string {
+		if filename, ok := cached[href]; ok {
+			return filename
+		}
+		return href
+	})
+	data, err := doc.Marshal()
+	if err != nil {
+		return fail(err)
+	}
+	return string(data), nil
+}
+
+// fileURL returns the file URL of filename
+func fileURL(filename string) string {
+	p := filepath.ToSlash(filename)
+	// Windows paths start with the drive letter
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// EOF
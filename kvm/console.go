@@ -0,0 +1,86 @@
+// -*- go -*-
+
+package kvm
+
+// ConsoleKind tells how a console session is presented to the user
+type ConsoleKind int
+
+const (
+	// JNLPConsole is a Java Web Start viewer
+	JNLPConsole ConsoleKind = iota
+	// HTML5Console is opened in the user's web browser
+	HTML5Console
+	// VNCConsole is opened with a VNC viewer
+	VNCConsole
+)
+
+// Console is a console session ready to be launched
+type Console struct {
+	Kind ConsoleKind
+	// JNLP is the viewer document of a JNLPConsole
+	JNLP string
+	// URL is the already authenticated address of an HTML5Console
+	URL string
+	// Addr is the host:port a VNCConsole viewer connects to
+	Addr string
+	// Password is the password of a VNCConsole, empty if none
+	Password string
+}
+
+// ConsoleDriver is implemented by drivers which do not always hand
+// out a JNLP viewer, e.g. because newer firmware only comes with an
+// HTML5 console. Drivers without it are JNLP only.
+type ConsoleDriver interface {
+	Console() (*Console, error)
+}
+
+// VNCDriver is implemented by drivers of BMCs with a built-in VNC
+// server, which can be used instead of their usual console.
+type VNCDriver interface {
+	VNCConsole() (*Console, error)
+}
+
+// Console returns the console session for the KVM, the jars of JNLP
+// viewers point at the jar cache when one is configured
+func (d *KVM) Console() (*Console, error) {
+	var console *Console
+	if driver, ok := d.Driver.(ConsoleDriver); ok {
+		var err error
+		if console, err = driver.Console(); err != nil {
+			return nil, &Error{Op: "console", Vendor: d.Vendor, Host: d.Driver.GetHost(), Err: err}
+		}
+	} else {
+		viewer, err := d.Driver.Viewer()
+		if err != nil {
+			return nil, &Error{Op: "viewer", Vendor: d.Vendor, Host: d.Driver.GetHost(), Err: err}
+		}
+		console = &Console{Kind: JNLPConsole, JNLP: viewer}
+	}
+
+	if console.Kind == JNLPConsole && d.Config.Cache != nil {
+		viewer, err := d.cacheViewer(console.JNLP)
+		if err != nil {
+			d.Close()
+			return nil, &Error{Op: "cache", Vendor: d.Vendor, Host: d.Driver.GetHost(), Err: err}
+		}
+		console.JNLP = viewer
+	}
+	return console, nil
+}
+
+// VNCConsole returns a VNCConsole session for the KVM built-in VNC
+// server, it fails with ErrVNCUnsupported for drivers without one
+func (d *KVM) VNCConsole() (*Console, error) {
+	driver, ok := d.Driver.(VNCDriver)
+	if !ok {
+		return nil, &Error{Op: "vnc", Vendor: d.Vendor, Host: d.Driver.GetHost(), Err: ErrVNCUnsupported}
+	}
+
+	console, err := driver.VNCConsole()
+	if err != nil {
+		return nil, &Error{Op: "vnc", Vendor: d.Vendor, Host: d.Driver.GetHost(), Err: err}
+	}
+	return console, nil
+}
+
+// EOF
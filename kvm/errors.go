@@ -0,0 +1,51 @@
+// -*- go -*-
+
+package kvm
+
+import (
+	"errors"
+)
+
+// Sentinel errors returned (wrapped) by the kvm package and vendor
+// drivers, test for them with errors.Is
+var (
+	// ErrUnsupportedVendor is returned for vendors that were never registered
+	ErrUnsupportedVendor = errors.New("unsupported KVM vendor")
+	// ErrUnsupportedVersion is returned when a driver has no viewer for a version
+	ErrUnsupportedVersion = errors.New("unsupported KVM version")
+	// ErrAuthFailed is returned when the BMC rejected the credentials
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrUnreachable is returned when the BMC could not be contacted
+	ErrUnreachable = errors.New("BMC unreachable")
+	// ErrPortRequired is returned by KVM switch drivers without a port
+	ErrPortRequired = errors.New("KVM switch port required")
+	// ErrVNCUnsupported is returned for BMCs without a usable VNC server
+	ErrVNCUnsupported = errors.New("no VNC server on KVM")
+)
+
+// Error records a failed KVM operation together with the vendor and host
+// it was made for, so callers handling many hosts can report per host.
+type Error struct {
+	Op     string
+	Vendor string
+	Host   string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	s := e.Op
+	if e.Vendor != "" {
+		s += " " + e.Vendor
+	}
+	if e.Host != "" {
+		s += " " + e.Host
+	}
+	return s + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// EOF
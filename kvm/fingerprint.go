@@ -0,0 +1,193 @@
+// -*- go -*-
+
+package kvm
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Match is the outcome of a successful vendor fingerprint
+type Match struct {
+	// Vendor is the canonical name of the matched vendor
+	Vendor string
+	// Version is the detected vendor specific version, or -1
+	Version int
+	// Reason explains which evidence the decision is based on
+	Reason string
+}
+
+// Probe gives vendor fingerprint functions cached access to the
+// web interface of a BMC, so that each well-known path is fetched
+// at most once whatever the number of registered vendors.
+type Probe struct {
+	Host   string
+	Client *http.Client
+
+	responses map[string]*ProbeResponse
+	failures  map[string]error
+	redfish   map[string]interface{}
+}
+
+// ProbeResponse is a cached response to a Probe request
+type ProbeResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	TLS        []*x509.Certificate
+}
+
+// NewProbe creates a Probe for host
+func NewProbe(host string, insecureSkipVerify bool) *Probe {
+	return &Probe{
+		Host:      host,
+		Client:    NewHTTPClient(insecureSkipVerify),
+		responses: make(map[string]*ProbeResponse),
+		failures:  make(map[string]error),
+	}
+}
+
+// Get fetches path over HTTPS from the probed host
+func (p *Probe) Get(path string) (*ProbeResponse, error) {
+	if res, ok := p.responses[path]; ok {
+		return res, nil
+	}
+	if err, ok := p.failures[path]; ok {
+		return nil, err
+	}
+
+	res, err := p.Client.Get("https://" + p.Host + path)
+	if err != nil {
+		p.failures[path] = err
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		p.failures[path] = err
+		return nil, err
+	}
+
+	response := &ProbeResponse{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       body,
+	}
+	if res.TLS != nil {
+		response.TLS = res.TLS.PeerCertificates
+	}
+	p.responses[path] = response
+	return response, nil
+}
+
+// Contains reports whether path answers 200 with marker in its body,
+// anything else, such as a redirect to a generic login page, proves
+// nothing about the vendor
+func (p *Probe) Contains(path string, marker string) bool {
+	res, err := p.Get(path)
+	return err == nil && res.StatusCode == http.StatusOK && strings.Contains(string(res.Body), marker)
+}
+
+// Certificate returns the TLS certificate presented by the host
+func (p *Probe) Certificate() *x509.Certificate {
+	res, err := p.Get("/")
+	if err != nil || len(res.TLS) == 0 {
+		return nil
+	}
+	return res.TLS[0]
+}
+
+// CertificateSubject returns the subject of the TLS certificate
+// presented by the host, or an empty string
+func (p *Probe) CertificateSubject() string {
+	if cert := p.Certificate(); cert != nil {
+		return cert.Subject.String()
+	}
+	return ""
+}
+
+// Server returns the Server header sent by the host
+func (p *Probe) Server() string {
+	res, err := p.Get("/")
+	if err != nil {
+		return ""
+	}
+	return res.Header.Get("Server")
+}
+
+// Redfish returns the decoded Redfish service root (/redfish/v1),
+// which BMCs serve without authentication, or nil
+func (p *Probe) Redfish() map[string]interface{} {
+	if p.redfish != nil {
+		return p.redfish
+	}
+	res, err := p.Get("/redfish/v1")
+	if err != nil || res.StatusCode != http.StatusOK {
+		return nil
+	}
+	if err := json.Unmarshal(res.Body, &p.redfish); err != nil {
+		return nil
+	}
+	return p.redfish
+}
+
+// RedfishVendor reports whether the Redfish service root names
+// vendor either as its Vendor or as one of its Oem sections
+func (p *Probe) RedfishVendor(vendor string) bool {
+	root := p.Redfish()
+	if root == nil {
+		return false
+	}
+	if v, ok := root["Vendor"].(string); ok && strings.EqualFold(v, vendor) {
+		return true
+	}
+	if oem, ok := root["Oem"].(map[string]interface{}); ok {
+		for k := range oem {
+			if strings.EqualFold(k, vendor) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Fingerprint probes host and returns the first registered vendor
+// recognizing it. The strong evidence of every vendor is looked at
+// before any vendor probes its paths, so that a path answering on
+// another vendor's BMC can't shadow it.
+func Fingerprint(host string, insecureSkipVerify bool) (*Match, error) {
+	probe := NewProbe(host, insecureSkipVerify)
+
+	// Make sure the host answers at all before asking every vendor
+	if _, err := probe.Get("/"); err != nil {
+		return nil, &Error{Op: "fingerprint", Host: host, Err: fmt.Errorf("%v: %w", err, ErrUnreachable)}
+	}
+
+	for _, vendor := range Vendors() {
+		if vendor.Fingerprint == nil {
+			continue
+		}
+		if match := vendor.Fingerprint(probe); match != nil {
+			match.Vendor = vendor.Name
+			return match, nil
+		}
+	}
+	for _, vendor := range Vendors() {
+		if vendor.ProbePaths == nil {
+			continue
+		}
+		if match := vendor.ProbePaths(probe); match != nil {
+			match.Vendor = vendor.Name
+			return match, nil
+		}
+	}
+
+	return nil, &Error{Op: "fingerprint", Host: host, Err: ErrUnsupportedVendor}
+}
+
+// EOF
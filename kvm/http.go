@@ -0,0 +1,32 @@
+// -*- go -*-
+
+package kvm
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// NewHTTPClient returns the HTTP client drivers use to talk to a BMC web
+// interface. BMCs almost always come with self-signed certificates, so
+// certificate checks are only done when insecureSkipVerify is false.
+func NewHTTPClient(insecureSkipVerify bool) *http.Client {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: insecureSkipVerify,
+		},
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+// EOF
@@ -4,19 +4,25 @@ package kvm
 
 import (
 	"errors"
-	"github.com/utsl42/drac-kvm/dell"
-	"github.com/utsl42/drac-kvm/hp"
-	"github.com/utsl42/drac-kvm/supermicro"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/cache"
 )
 
-// Driver is interface for all usable kvm drivers
-// 	HP iLO, Dell idrac, Supermicro, IBM
+// Driver is interface for all usable kvm drivers, vendor packages
+// make their driver available by calling Register.
+//
 // Every one of them needs to support following methods
-//  - Viewer which will return buffer with generated template
-//  - GetHost/GetUsername/GetPassword
+//   - Viewer which will return buffer with generated template
+//   - GetHost/GetUsername/GetPassword
+//
+// Drivers keeping a BMC session open for the viewer also implement
+// io.Closer to log out once the viewer exited.
 type Driver interface {
 	Viewer() (string, error)
 	GetHost() string
@@ -27,6 +33,8 @@ type Driver interface {
 // Config is simple config structure
 type Config struct {
 	InsecureSkipVerify bool
+	// Cache keeps the jars of JNLP viewers when not nil
+	Cache *cache.Cache
 }
 
 // KVM contains all of the information required
@@ -40,115 +48,144 @@ type KVM struct {
 // CreateKVM will create KVM structure based on input it will assign proper
 // driver to interface.
 func CreateKVM(Host string, Username string, Password string, Vendor string,
-	Version int, InsecureSkipVerify bool) *KVM {
+	Version int, InsecureSkipVerify bool) (*KVM, error) {
+
+	return NewKVM(Vendor, Options{
+		Host:     Host,
+		Username: Username,
+		Password: Password,
+		Version:  Version,
+		Config: Config{
+			InsecureSkipVerify: InsecureSkipVerify,
+		},
+	})
+}
 
-	var driver Driver
+// NewKVM creates a KVM for a vendor from Options, unlike CreateKVM
+// it gives access to every option, e.g. the port of a KVM switch.
+func NewKVM(Vendor string, opts Options) (*KVM, error) {
 
-	switch vn := Vendor; vn {
-	case "dell":
-		driver = &dell.KvmDellDriver{
-			Host:     Host,
-			Username: Username,
-			Password: Password,
-			Version:  Version,
-		}
-	case "supermicro":
-		driver = &supermicro.KvmSupermicroDriver{
-			Host:     Host,
-			Username: Username,
-			Password: Password,
-			Version:  169,
-		}
-	case "hp":
-		driver = &hp.KvmHpDriver{
-			Host:     Host,
-			Username: Username,
-			Password: Password,
-			Version:  -1,
-		}
-	case "ibm":
-		log.Fatalf("IBM/Lennovo support not implemented yet KVM as driver: %s", vn)
-	default:
-		log.Fatalf("Unsupported KVM vendor %s", vn)
+	vendor, err := lookupVendor("create", Vendor)
+	if err != nil {
+		return nil, err
 	}
 
 	kvm := &KVM{
-		Vendor: Vendor,
-		Config: Config{
-			InsecureSkipVerify: InsecureSkipVerify,
-		},
-		Driver: driver,
+		Vendor: vendor.Name,
+		Config: opts.Config,
+		Driver: vendor.New(opts),
 	}
 
-	return kvm
+	return kvm, nil
 }
 
 // GetJnlpFile Creates JNLP file and return PATH to it
-func (d *KVM) GetJnlpFile() string {
+func (d *KVM) GetJnlpFile() (string, error) {
 
-	viewer, err := d.Driver.Viewer()
+	console, err := d.Console()
 	if err != nil {
-		log.Fatalf("Unable to generate DRAC viewer for %s@%s (%s)", d.Driver.GetUsername(), d.Driver.GetHost(), err)
+		return "", err
+	}
+	if console.Kind != JNLPConsole {
+		return "", &Error{Op: "viewer", Vendor: d.Vendor, Host: d.Driver.GetHost(), Err: errors.New("console is not a JNLP viewer")}
 	}
 
-	// Write out the kvm viewer to a temporary file so that
-	// we can launch it with the javaws program
-	filename := os.TempDir() + string(os.PathSeparator) + "kvm_" + d.Driver.GetHost() + ".jnlp"
+	return d.WriteJnlpFile(console.JNLP)
+}
 
-	ioutil.WriteFile(filename, []byte(viewer), 0600)
+// unsafeHostRe matches what is not kept of the host in file names
+var unsafeHostRe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// WriteJnlpFile writes the viewer of a JNLPConsole to a file in a new
+// private directory and returns PATH to it. The name is unique, so
+// sessions to the same host don't clobber each other, and nobody else
+// can read the credentials in it or plant a symlink in its place.
+// RemoveJnlpFile deletes the file and its directory.
+func (d *KVM) WriteJnlpFile(viewer string) (string, error) {
+
+	dir, err := ioutil.TempDir("", "drac-kvm")
+	if err != nil {
+		return "", &Error{Op: "write jnlp", Vendor: d.Vendor, Host: d.Driver.GetHost(), Err: err}
+	}
 
-	return filename
+	// Write out the kvm viewer so that we can launch it with the
+	// javaws program
+	filename := filepath.Join(dir, "kvm_"+unsafeHostRe.ReplaceAllString(d.Driver.GetHost(), "_")+".jnlp")
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		_, err = f.WriteString(viewer)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", &Error{Op: "write jnlp", Vendor: d.Vendor, Host: d.Driver.GetHost(), Err: err}
+	}
+
+	return filename, nil
+}
+
+// RemoveJnlpFile deletes a file written by WriteJnlpFile along with
+// its private directory, other files are just removed
+func RemoveJnlpFile(filename string) error {
+	dir := filepath.Dir(filename)
+	if !strings.HasPrefix(filepath.Base(dir), "drac-kvm") {
+		return os.Remove(filename)
+	}
+	return os.RemoveAll(dir)
+}
+
+// HasSession reports whether the driver holds a BMC session open
+// while the viewer runs, which Close ends
+func (d *KVM) HasSession() bool {
+	_, ok := d.Driver.(io.Closer)
+	return ok
+}
+
+// Close ends the BMC session a driver may hold open while the
+// viewer runs, drivers do so by implementing io.Closer
+func (d *KVM) Close() error {
+	if closer, ok := d.Driver.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
 }
 
 // GetDefaultUsername returns default KVM vendor user
-func GetDefaultUsername(Vendor string) string {
-	switch vn := Vendor; vn {
-	case "dell":
-		return dell.DefaultUsername
-	case "supermicro":
-		return supermicro.DefaultUsername
-	case "hp":
-		return hp.DefaultUsername
-	case "ibm":
-		log.Fatalf("IBM/Lennovo support not implemented yet KVM vendor %s", vn)
-	default:
-		log.Fatalf("Unsupported KVM vendor %s", vn)
+func GetDefaultUsername(Vendor string) (string, error) {
+	vendor, err := lookupVendor("default username", Vendor)
+	if err != nil {
+		return "", err
 	}
-	return ""
+	return vendor.DefaultUsername, nil
 }
 
 // GetDefaultPassword returns default KVM vendor password
-func GetDefaultPassword(Vendor string) string {
-	switch vn := Vendor; vn {
-	case "dell":
-		return dell.DefaultPassword
-	case "supermicro":
-		return supermicro.DefaultPassword
-	case "hp":
-		return hp.DefaultPassword
-	case "ibm":
-		log.Fatalf("IBM/Lennovo support not implemented yet KVM vendor %s", vn)
-	default:
-		log.Fatalf("Unsupported KVM vendor %s", vn)
+func GetDefaultPassword(Vendor string) (string, error) {
+	vendor, err := lookupVendor("default password", Vendor)
+	if err != nil {
+		return "", err
 	}
-	return ""
+	return vendor.DefaultPassword, nil
 }
 
 // CheckVendorString will test if provided vendor is supported
 func CheckVendorString(Vendor string) (int, error) {
-	switch vn := Vendor; vn {
-	case "dell":
-		break
-	case "supermicro":
-		break
-	case "hp":
-		break
-	case "ibm":
-		fallthrough
-	default:
-		return 1, errors.New("provided vendor not supported")
+	if _, err := lookupVendor("check", Vendor); err != nil {
+		return 1, err
 	}
 	return 0, nil
 }
 
+// lookupVendor is LookupVendor returning an ErrUnsupportedVendor
+// error for unknown vendors
+func lookupVendor(op string, name string) (*Vendor, error) {
+	vendor, ok := LookupVendor(name)
+	if !ok {
+		return nil, &Error{Op: op, Vendor: name, Err: ErrUnsupportedVendor}
+	}
+	return vendor, nil
+}
+
 // EOF
@@ -0,0 +1,95 @@
+// -*- go -*-
+
+package kvm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Legacy is a set of allowances older BMC firmware needs from modern
+// Java runtimes, which refuse its TLS setup or jar signatures
+type Legacy int
+
+const (
+	// LegacyTLS allows TLS 1.0 and 1.1
+	LegacyTLS Legacy = 1 << iota
+	// LegacyCiphers allows RC4 and 3DES cipher suites
+	LegacyCiphers
+	// LegacyMD5Jars allows jars signed with MD5 or SHA-1
+	LegacyMD5Jars
+	// LegacyWeakKeys allows 1024-bit RSA, DSA and DH keys
+	LegacyWeakKeys
+
+	// LegacyAll allows everything above
+	LegacyAll = LegacyTLS | LegacyCiphers | LegacyMD5Jars | LegacyWeakKeys
+)
+
+// legacyNames are the names of the allowances in configuration files
+var legacyNames = []struct {
+	name   string
+	legacy Legacy
+}{
+	{"tls", LegacyTLS},
+	{"ciphers", LegacyCiphers},
+	{"md5", LegacyMD5Jars},
+	{"weak-keys", LegacyWeakKeys},
+}
+
+// ParseLegacy parses a comma separated list of allowances, "all" and
+// "none" are accepted as well
+func ParseLegacy(s string) (Legacy, error) {
+	var legacy Legacy
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		switch name {
+		case "", "none":
+			continue
+		case "all":
+			legacy |= LegacyAll
+			continue
+		}
+
+		found := false
+		for _, n := range legacyNames {
+			if n.name == name {
+				legacy |= n.legacy
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown legacy allowance %s", name)
+		}
+	}
+	return legacy, nil
+}
+
+func (l Legacy) String() string {
+	var names []string
+	for _, n := range legacyNames {
+		if l&n.legacy != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// LegacyDriver is implemented by drivers of BMCs whose viewers need
+// legacy allowances, usually depending on the firmware version
+type LegacyDriver interface {
+	Legacy() Legacy
+}
+
+// Legacy returns the allowances the viewer of the KVM needs, it is
+// only known once the console was requested
+func (d *KVM) Legacy() Legacy {
+	if driver, ok := d.Driver.(LegacyDriver); ok {
+		return driver.Legacy()
+	}
+	return 0
+}
+
+// EOF
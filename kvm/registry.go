@@ -0,0 +1,114 @@
+// -*- go -*-
+
+package kvm
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Options holds everything a vendor Factory needs to know
+// to build a Driver for a single KVM host
+type Options struct {
+	Host     string
+	Username string
+	Password string
+	Version  int
+	// Port is the target port on KVM switches, 0 when not used
+	Port int
+	// VNCPassword is the password of the BMC built-in VNC server,
+	// drivers fall back to Password when it is empty
+	VNCPassword string
+	Config
+}
+
+// Factory creates a vendor specific Driver from Options
+type Factory func(opts Options) Driver
+
+// Vendor describes a KVM vendor driver. Vendor packages call
+// Register from their init function so that adding a new vendor
+// never requires touching this package.
+type Vendor struct {
+	// Name is the canonical vendor name used with --vendor
+	Name string
+	// Aliases are alternative names accepted for the vendor
+	Aliases []string
+	// Description is a short human readable description
+	Description string
+	// DefaultUsername is the factory default BMC username
+	DefaultUsername string
+	// DefaultPassword is the factory default BMC password
+	DefaultPassword string
+	// Versions lists the supported vendor specific versions,
+	// an empty list means the driver does not need a version
+	Versions []int
+	// New creates a Driver for this vendor
+	New Factory
+	// Fingerprint recognizes the vendor's BMC from strong evidence
+	// (certificate subject, Server header, Redfish service root), it
+	// returns nil when the probed host does not belong to this vendor
+	Fingerprint func(p *Probe) *Match
+	// ProbePaths recognizes the vendor's BMC by paths only it serves,
+	// it is tried once no vendor recognized the host by Fingerprint
+	ProbePaths func(p *Probe) *Match
+}
+
+var (
+	vendorsMu sync.RWMutex
+	vendors   = make(map[string]*Vendor)
+	aliases   = make(map[string]string)
+)
+
+// Register makes a vendor driver available by its name and aliases.
+// It panics if Register is called twice with the same name or alias
+// or if the vendor has no Factory.
+func Register(v Vendor) {
+	vendorsMu.Lock()
+	defer vendorsMu.Unlock()
+
+	if v.New == nil {
+		panic("kvm: Register factory is nil for vendor " + v.Name)
+	}
+
+	names := append([]string{v.Name}, v.Aliases...)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if _, dup := aliases[name]; dup {
+			panic("kvm: Register called twice for vendor " + name)
+		}
+	}
+
+	vendor := v
+	vendors[strings.ToLower(v.Name)] = &vendor
+	for _, name := range names {
+		aliases[strings.ToLower(name)] = strings.ToLower(v.Name)
+	}
+}
+
+// LookupVendor returns the registered vendor for a name or alias
+func LookupVendor(name string) (*Vendor, bool) {
+	vendorsMu.RLock()
+	defer vendorsMu.RUnlock()
+
+	canonical, ok := aliases[strings.ToLower(name)]
+	if !ok {
+		return nil, false
+	}
+	return vendors[canonical], true
+}
+
+// Vendors returns all registered vendors sorted by name
+func Vendors() []*Vendor {
+	vendorsMu.RLock()
+	defer vendorsMu.RUnlock()
+
+	list := make([]*Vendor, 0, len(vendors))
+	for _, v := range vendors {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// EOF
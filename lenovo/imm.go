@@ -0,0 +1,273 @@
+// -*- go -*-
+
+package lenovo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// KvmLenovoDriver is Lenovo/IBM specific folder for KVM driver.
+type KvmLenovoDriver struct {
+	Host     string
+	Username string
+	Password string
+	Version  int
+
+	InsecureSkipVerify bool
+
+	// client keeps the IMM2 session cookie until Close
+	client *http.Client
+}
+
+const (
+	// DefaultUsername is the default username on IMM2 and XCC
+	DefaultUsername = "USERID"
+	// DefaultPassword is the default password on IMM2 and XCC
+	DefaultPassword = "PASSW0RD"
+)
+
+const (
+	// IMM2 is the version of the Integrated Management Module II
+	IMM2 = 2
+	// XCC is the version of the XClarity Controller
+	XCC = 3
+)
+
+// loginMarkers are matched against the BMC login page
+var loginMarkers = []struct {
+	re      *regexp.Regexp
+	version int
+}{
+	{regexp.MustCompile(`XClarity Controller|\bXCC\b`), XCC},
+	{regexp.MustCompile(`Integrated Management Module II|\bIMM2\b`), IMM2},
+}
+
+// brandRe has to match too before a login page is taken for a Lenovo
+// one, XCC or IMM2 alone could appear on any page
+var brandRe = regexp.MustCompile(`(?i)\b(lenovo|ibm)\b`)
+
+func init() {
+	kvm.Register(kvm.Vendor{
+		Name:            "lenovo",
+		Aliases:         []string{"ibm", "imm", "xcc"},
+		Description:     "Lenovo/IBM IMM2 and XClarity Controller",
+		DefaultUsername: DefaultUsername,
+		DefaultPassword: DefaultPassword,
+		Versions:        []int{IMM2, XCC},
+		New: func(opts kvm.Options) kvm.Driver {
+			return &KvmLenovoDriver{
+				Host:     opts.Host,
+				Username: opts.Username,
+				Password: opts.Password,
+				Version:  opts.Version,
+
+				InsecureSkipVerify: opts.InsecureSkipVerify,
+			}
+		},
+		Fingerprint: fingerprint,
+		ProbePaths:  probePaths,
+	})
+}
+
+// fingerprint recognizes an IMM2 or XCC by its Redfish service root
+func fingerprint(p *kvm.Probe) *kvm.Match {
+	if p.RedfishVendor("Lenovo") {
+		return &kvm.Match{Version: -1, Reason: "Redfish service root names Lenovo"}
+	}
+	return nil
+}
+
+// probePaths recognizes the IMM2 and XCC login pages
+func probePaths(p *kvm.Probe) *kvm.Match {
+	for _, page := range []string{"/", "/designs/imm/index.php"} {
+		res, err := p.Get(page)
+		if err != nil || res.StatusCode != http.StatusOK || !brandRe.Match(res.Body) {
+			continue
+		}
+		for _, marker := range loginMarkers {
+			if found := marker.re.Find(res.Body); found != nil {
+				return &kvm.Match{Version: marker.version, Reason: fmt.Sprintf("login page mentions %s", found)}
+			}
+		}
+	}
+	return nil
+}
+
+// DetectVersion tells IMM2 and XCC apart by their login page
+func DetectVersion(client *http.Client, host string) (int, error) {
+	res, err := client.Get("https://" + host + "/")
+	if err != nil {
+		return -1, fmt.Errorf("unable to detect BMC version (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+
+	body, _ := ioutil.ReadAll(res.Body)
+	for _, marker := range loginMarkers {
+		if marker.re.Match(body) {
+			return marker.version, nil
+		}
+	}
+	return -1, fmt.Errorf("unable to detect BMC version: %w", kvm.ErrUnsupportedVersion)
+}
+
+// detectVersion detects IMM2 or XCC when no version was given
+func (d *KvmLenovoDriver) detectVersion(client *http.Client) error {
+	if d.Version < 0 {
+		log.Printf("Detecting IMM version...")
+		version, err := DetectVersion(client, d.Host)
+		if err != nil {
+			return err
+		}
+		d.Version = version
+	}
+	if d.Version != IMM2 && d.Version != XCC {
+		return fmt.Errorf("no support for IMM v%d: %w", d.Version, kvm.ErrUnsupportedVersion)
+	}
+	log.Printf("Found IMM version %d", d.Version)
+	return nil
+}
+
+// Console returns the Java remote console on IMM2 and the HTML5
+// remote console on XCC
+func (d *KvmLenovoDriver) Console() (*kvm.Console, error) {
+	client := kvm.NewHTTPClient(d.InsecureSkipVerify)
+
+	if err := d.detectVersion(client); err != nil {
+		return nil, err
+	}
+
+	if d.Version == IMM2 {
+		viewer, err := d.Viewer()
+		if err != nil {
+			return nil, err
+		}
+		return &kvm.Console{Kind: kvm.JNLPConsole, JNLP: viewer}, nil
+	}
+
+	// XCC hands out a bearer token the HTML5 console accepts
+	body, _ := json.Marshal(map[string]string{"username": d.Username, "password": d.Password})
+	res, err := client.Post("https://"+d.Host+"/api/login", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't login to XCC (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("couldn't login to XCC (%s): %w", res.Status, kvm.ErrAuthFailed)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("couldn't login to XCC (%s)", res.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return nil, fmt.Errorf("no access token in XCC login response: %w", kvm.ErrAuthFailed)
+	}
+
+	values := url.Values{"access_token": {token.AccessToken}}
+	return &kvm.Console{Kind: kvm.HTML5Console, URL: "https://" + d.Host + "/#/remoteControl?" + values.Encode()}, nil
+}
+
+// Viewer logs in to the IMM2 web API and downloads the Java remote
+// console JNLP for that session
+func (d *KvmLenovoDriver) Viewer() (string, error) {
+	if d.Version == XCC {
+		return "", fmt.Errorf("XCC has no Java remote console, use its HTML5 console: %w", kvm.ErrUnsupportedVersion)
+	}
+
+	client := kvm.NewHTTPClient(d.InsecureSkipVerify)
+	client.Jar, _ = cookiejar.New(nil)
+
+	values := url.Values{"user": {d.Username}, "password": {d.Password}, "SessionTimeout": {"1200"}}
+	res, err := client.PostForm("https://"+d.Host+"/data/login", values)
+	if err != nil {
+		return "", fmt.Errorf("couldn't login to IMM (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't login to IMM (%s)", res.Status)
+	}
+
+	var result struct {
+		AuthResult string `json:"authResult"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("couldn't decode IMM login response: %v", err)
+	}
+	if result.AuthResult != "0" {
+		return "", fmt.Errorf("IMM login refused (authResult %s): %w", result.AuthResult, kvm.ErrAuthFailed)
+	}
+	d.client = client
+
+	res, err = client.Get("https://" + d.Host + "/designs/imm/viewer.jnlp")
+	if err != nil {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp (%s)", res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		d.Close()
+		return "", err
+	}
+	if !bytes.Contains(body, []byte("<jnlp")) {
+		d.Close()
+		return "", errors.New("IMM did not return a jnlp")
+	}
+	viewer, err := jnlp.Normalize(body)
+	if err != nil {
+		d.Close()
+	}
+	return viewer, err
+}
+
+// Close logs out of the IMM2 session opened by Viewer
+func (d *KvmLenovoDriver) Close() error {
+	if d.client == nil {
+		return nil
+	}
+	client := d.client
+	d.client = nil
+
+	res, err := client.Get("https://" + d.Host + "/data/logout")
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// GetHost return Configured driver Host
+func (d *KvmLenovoDriver) GetHost() string {
+	return d.Host
+}
+
+// GetUsername return Configured driver Username
+func (d *KvmLenovoDriver) GetUsername() string {
+	return d.Username
+}
+
+// GetPassword return Configured driver Password
+func (d *KvmLenovoDriver) GetPassword() string {
+	return d.Password
+}
+
+// EOF
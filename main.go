@@ -9,9 +9,15 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/utsl42/drac-kvm/cache"
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/jre"
 	"github.com/utsl42/drac-kvm/kvm"
 
 	"github.com/Unknwon/goconfig"
@@ -30,37 +36,82 @@ func promptPassword() string {
 	return string(password)
 }
 
-func getJavawsArgs(waitFlag bool) string {
-	var javawsArgs = "-jnlp"
+func listVendors() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "VENDOR\tALIASES\tDEFAULT USER\tVERSIONS\tDESCRIPTION")
+	for _, v := range kvm.Vendors() {
+		versions := make([]string, len(v.Versions))
+		for i, version := range v.Versions {
+			versions[i] = fmt.Sprint(version)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", v.Name, strings.Join(v.Aliases, ","),
+			v.DefaultUsername, strings.Join(versions, ","), v.Description)
+	}
+	w.Flush()
+}
 
-	cmd := exec.Command("java", "-version")
-	stderr, err := cmd.StderrPipe()
+// openURL opens url with the browser command. The url holds the
+// session credentials, it is only printed when the command is
+// explicitly empty.
+func openURL(browser string, url string) error {
+	args := strings.Fields(browser)
+	if len(args) == 0 {
+		log.Printf("No browser given, printing the console URL, it holds the session credentials")
+		fmt.Println(url)
+		return nil
+	}
 
+	log.Printf("Opening HTML5 console with %s", browser)
+	args = append(args, url)
+	return exec.Command(args[0], args[1:]...).Start()
+}
+
+// runJNLP runs the viewer with java, the java binary of javaRuntime
+// when empty, java from the PATH when both are missing, without
+// javaws, until it exits. javaArgs are passed to the JVM.
+func runJNLP(java string, javaRuntime *jre.Runtime, viewer string, javaArgs []string) error {
+	doc, err := jnlp.Parse([]byte(viewer))
 	if err != nil {
-		//os.Remove(filename)
-		log.Fatalf("Java not present on your system... (%s)", err)
+		return err
 	}
 
-	if err := cmd.Start(); err != nil {
-		log.Fatal(err)
+	// The jars go to a private directory removed however drac-kvm
+	// exits, like the jnlp given to javaws
+	dir, err := ioutil.TempDir("", "drac-kvm")
+	if err != nil {
+		return err
 	}
+	removeOnExit(dir)
+	defer os.RemoveAll(dir)
 
-	slurp, _ := ioutil.ReadAll(stderr)
-	if err := cmd.Wait(); err != nil {
-		log.Fatal(err)
+	runner := &jnlp.Runner{
+		JavaArgs: javaArgs,
+		Client:   kvm.NewHTTPClient(true),
 	}
-
-	if strings.Contains(string(slurp[:]), "1.7") ||
-		strings.Contains(string(slurp[:]), "1.8") {
-		if waitFlag {
-			javawsArgs = "-wait"
-		} else {
-			javawsArgs = ""
+	var version jre.Version
+	if java == "" && javaRuntime != nil {
+		runner.Java = javaRuntime.Java
+		version = javaRuntime.Version
+	} else {
+		if java == "" {
+			java = "java"
+		}
+		runner.Java = java
+		// A java of unknown version gets an argument file, which an old
+		// one fails on without showing the viewer arguments
+		if version, err = jre.JavaVersion(java); err != nil {
+			log.Printf("Unable to tell the version of %s (%s), assuming Java %d or later", java, err, runnerFeature)
+			version = jre.Version{Feature: runnerFeature}
 		}
-
 	}
+	runner.LegacyArgs = version.Feature < runnerFeature
 
-	return javawsArgs
+	cmd, err := runner.Command(doc, dir)
+	if err != nil {
+		return err
+	}
+	log.Printf("Launching KVM session with %s", cmd.Path)
+	return cmd.Run()
 }
 
 func main() {
@@ -78,30 +129,48 @@ func main() {
 
 	// CLI flags
 	var _host = pflag.StringP("host", "h", "", "The DRAC host (or IP)")
-	var _vendor = pflag.StringP("vendor", "V", "", "The KVM Vendor")
+	var _vendor = pflag.StringP("vendor", "V", "", "The KVM Vendor, detected if not set")
 
 	var _username = pflag.StringP("username", "u", "", "The KVM username")
 	var _password = pflag.BoolP("password", "p", false, "Prompt for password (optional, will use default vendor if not present)")
-	var _version = pflag.IntP("version", "v", -1, "KVM vendor specific version for idrac: (6, 7 or 8)")
-
-	var _delay = pflag.IntP("delay", "d", 10, "Number of seconds to delay for javaws to start up & read jnlp before deleting it")
-	var _javaws = pflag.StringP("javaws", "j", DefaultJavaPath(), "The path to javaws binary")
-	var _wait = pflag.BoolP("wait", "w", false, "Wait for java console process end")
+	var _version = pflag.IntP("version", "v", -1, "KVM vendor specific version, e.g. idrac: (6, 7 or 8) or iLO: (3, 4 or 5), detected if not set")
+	var _port = pflag.IntP("port", "P", 0, "The target port on KVM switches (Raritan, Avocent)")
+
+	var _delay = pflag.IntP("delay", "d", 10, "Number of seconds to wait at most for javaws to read the jnlp before deleting it")
+	var _javaws = pflag.StringP("javaws", "j", "", "The path to javaws binary, the one of the selected Java runtime if not set")
+	var _java = pflag.String("java", "", "The java binary running viewers without javaws, the one of the selected Java runtime if not set")
+	var _javaHome = pflag.String("java-home", "", "The Java runtime to use, selected according to the viewer if not set")
+	var _launcher = pflag.String("launcher", "auto", "How JNLP viewers are run: javaws, java (built-in runner) or auto (javaws if installed)")
+	var _wait = pflag.BoolP("wait", "w", false, "Wait for java console process end, always done when there is a BMC session to log out of")
+	var _browser = pflag.StringP("browser", "b", DefaultBrowser(), "The command opening HTML5 consoles, the URL (holding the session credentials) is printed if empty")
+	var _viewer = pflag.String("viewer", "", "The viewer to use: auto (vendor console) or vnc (BMC built-in VNC server)")
+	var _delivery = pflag.String("jnlp-delivery", "", "How the jnlp is handed to javaws: file (private temporary file) or http (served once from 127.0.0.1)")
+	var _vncviewer = pflag.String("vncviewer", DefaultVNCViewer(), "The VNC viewer command used for VNC consoles")
+	var _listVendors = pflag.Bool("list-vendors", false, "List supported KVM vendors and exit")
+
+	var _offline = pflag.Bool("offline", false, "Use cached viewer jars without revalidating them")
+	var _noCache = pflag.Bool("no-cache", false, "Do not cache viewer jars")
+
+	// The jar cache subcommands have their own flags
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		runCache(os.Args[2:])
+		os.Exit(0)
+	}
 
 	// Parse the CLI flags
 	pflag.Parse()
 
+	if *_listVendors {
+		listVendors()
+		os.Exit(0)
+	}
+
 	if *_host == "" {
 		log.Printf("Host parameter is requried...")
 		pflag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	// Check we have access to the javaws binary
-	if _, err := os.Stat(*_javaws); err != nil {
-		log.Fatalf("No javaws binary found at %s", *_javaws)
-	}
-
 	// Search for existing config file
 	usr, _ := user.Current()
 	cfg, _ := goconfig.LoadConfigFile(usr.HomeDir + "/.drackvmrc")
@@ -124,23 +193,30 @@ func main() {
 	 *	1) Check if vendor was used as command line argument
 	 *	2) Try to load it from _host_ section of config
 	 *	3) Check if _defaults_ section of config contains _vendor_
-	 *	4) Use default "dell" value to keep original behaviour
+	 *	4) Fingerprint the host to find out which vendor it is
 	 *
 	 */
+	var match *kvm.Match
 	if *_vendor == "" {
 		if value, err := cfg.GetValue(*_host, "vendor"); err == nil {
 			vendor = value
 		} else {
-			// To keep old default behaviour we set vendor string to dell by default.
-			vendor = "dell"
+			log.Printf("Fingerprinting %s...", host)
+			if match, err = kvm.Fingerprint(host, true); err != nil {
+				log.Fatalf("Unable to detect KVM vendor (%s), use --vendor to set it", err)
+			}
+			log.Printf("Found vendor %s (version %d) based on %s", match.Vendor, match.Version, match.Reason)
+			vendor = match.Vendor
 		}
 	} else {
 		vendor = *_vendor
 	}
 
-	if _, err := kvm.CheckVendorString(vendor); err != nil {
+	kvmVendor, ok := kvm.LookupVendor(vendor)
+	if !ok {
 		log.Fatalf("Provided vendor: %s, is not supported consider adding support with Github PR...", vendor)
 	}
+	vendor = kvmVendor.Name
 
 	/*
 	 *  For loading username/password we have following order:
@@ -157,7 +233,7 @@ func main() {
 			if defaultvalue, err := cfg.GetValue("defaults", "username"); err == nil {
 				username = defaultvalue
 			} else {
-				username = kvm.GetDefaultUsername(vendor)
+				username = kvmVendor.DefaultUsername
 			}
 		}
 	} else {
@@ -171,18 +247,24 @@ func main() {
 			if defaultvalue, err := cfg.GetValue("defaults", "password"); err == nil {
 				password = defaultvalue
 			} else {
-				password = kvm.GetDefaultPassword(vendor)
+				password = kvmVendor.DefaultPassword
 			}
 		}
 	} else {
 		password = promptPassword()
 	}
 
-	// Version is only used with dell KVM vendor..
-	if vendor == "dell" && *_version == -1 {
-		if value, err := cfg.Int(*_host, "version"); err == nil {
-			version = value
-		} else {
+	// Version is vendor specific, -1 lets the driver detect it. It is
+	// only read from the section of the host itself (not from a parent
+	// section of a dotted name), and [defaults] version predates the
+	// other vendors, it is a Dell version.
+	version = -1
+	if *_version == -1 {
+		if section, err := cfg.GetSection(*_host); err == nil && section["version"] != "" {
+			if version, err = cfg.Int(*_host, "version"); err != nil {
+				log.Fatalf("Invalid version for %s (%s)", *_host, err)
+			}
+		} else if vendor == "dell" {
 			if defaultvalue, err := cfg.Int("defaults", "version"); err == nil {
 				version = defaultvalue
 			}
@@ -190,19 +272,310 @@ func main() {
 	} else {
 		version = *_version
 	}
+	if version == -1 && match != nil {
+		version = match.Version
+	}
+
+	// Port is only used with KVM switches
+	port := *_port
+	if port == 0 {
+		if value, err := cfg.Int(*_host, "port"); err == nil {
+			port = value
+		}
+	}
 
-	filename := kvm.CreateKVM(host, username, password, vendor, version, true).GetJnlpFile()
-	defer os.Remove(filename)
+	// The VNC server password defaults to the BMC password
+	vncPassword, _ := cfg.GetValue(*_host, "vnc_password")
 
-	// Launch it!
-	log.Printf("Launching KVM session with %s", filename)
-	if err := exec.Command(*_javaws, getJavawsArgs(*_wait), filename, "-nosecurity", "-noupdate", "-Xnofork").Run(); err != nil {
-		os.Remove(filename)
-		log.Fatalf("Unable to launch DRAC (%s), from file %s", err, filename)
+	viewer := *_viewer
+	if viewer == "" {
+		if value, err := cfg.GetValue(*_host, "viewer"); err == nil {
+			viewer = value
+		} else if defaultvalue, err := cfg.GetValue("defaults", "viewer"); err == nil {
+			viewer = defaultvalue
+		} else {
+			viewer = "auto"
+		}
+	}
+	if viewer != "auto" && viewer != "vnc" {
+		log.Fatalf("Unknown viewer %s, use auto or vnc", viewer)
+	}
+
+	delivery := *_delivery
+	if delivery == "" {
+		if value, err := cfg.GetValue(*_host, "jnlp_delivery"); err == nil {
+			delivery = value
+		} else if defaultvalue, err := cfg.GetValue("defaults", "jnlp_delivery"); err == nil {
+			delivery = defaultvalue
+		} else {
+			delivery = "file"
+		}
+	}
+	if delivery != "file" && delivery != "http" {
+		log.Fatalf("Unknown jnlp delivery %s, use file or http", delivery)
+	}
+	if *_launcher != "auto" && *_launcher != "javaws" && *_launcher != "java" {
+		log.Fatalf("Unknown launcher %s, use auto, javaws or java", *_launcher)
+	}
+
+	// Viewer jars are kept in the user cache dir
+	var jarCache *cache.Cache
+	if !*_noCache {
+		if dir, err := cache.DefaultDir(); err == nil {
+			jarCache = &cache.Cache{Dir: dir, Client: kvm.NewHTTPClient(true), Offline: *_offline}
+		} else {
+			log.Printf("Not caching viewer jars (%s)", err)
+		}
 	}
 
-	// Give javaws a few seconds to start & read the jnlp
-	time.Sleep(time.Duration(*_delay) * time.Second)
+	// Temporary files may hold credentials, they go whatever happens
+	handleSignals()
+
+	session, err := kvm.NewKVM(vendor, kvm.Options{
+		Host:        host,
+		Username:    username,
+		Password:    password,
+		Version:     version,
+		Port:        port,
+		VNCPassword: vncPassword,
+		Config: kvm.Config{
+			InsecureSkipVerify: true,
+			Cache:              jarCache,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Unable to create KVM session (%s)", err)
+	}
+
+	var console *kvm.Console
+	if viewer == "vnc" {
+		console, err = session.VNCConsole()
+	} else {
+		console, err = session.Console()
+	}
+	if err != nil {
+		log.Fatalf("Unable to generate DRAC viewer for %s@%s (%s)", username, host, err)
+	}
+
+	// keepSession is set when javaws returns before the viewer exits
+	var keepSession bool
+	switch console.Kind {
+	case kvm.HTML5Console:
+		// Launch it in the browser!
+		// The URL carries the session token, it is not printed when
+		// the browser fails, the session is given up and the user
+		// logs in on their own
+		if err := openURL(*_browser, console.URL); err != nil {
+			session.Close()
+			fatalf("Unable to open a browser (%s), open https://%s/ and log in yourself", err, host)
+		}
+
+		// The browser console lives on in the BMC session, there is
+		// no viewer process to wait for, so it is not logged out
+		log.Printf("Leaving the BMC session open for the browser console")
+		removeTempDirs()
+		return
+
+	case kvm.VNCConsole:
+		var passwordFile string
+		if console.Password != "" {
+			dir, filename, err := writeVNCPasswordFile(console.Password)
+			if err != nil {
+				session.Close()
+				fatalf("Unable to write VNC password file (%s)", err)
+			}
+			removeOnExit(dir)
+			passwordFile = filename
+		}
+
+		// The console may be bridged by the driver, so it has to
+		// stay open as long as the viewer runs
+		if err := runVNCViewer(*_vncviewer, console.Addr, passwordFile); err != nil {
+			session.Close()
+			fatalf("Unable to launch VNC viewer (%s), connect to %s yourself", err, console.Addr)
+		}
+
+	default:
+		// The Java runtime is pinned with java_home or matched against
+		// the j2se version the viewer asks for
+		javaHome := *_javaHome
+		if javaHome == "" {
+			if value, err := cfg.GetValue(*_host, "java_home"); err == nil {
+				javaHome = value
+			} else if defaultvalue, err := cfg.GetValue("defaults", "java_home"); err == nil {
+				javaHome = defaultvalue
+			}
+		}
+		javaPaths, _ := cfg.GetValue("defaults", "java_paths")
+
+		var j2se []string
+		if doc, err := jnlp.Parse([]byte(console.JNLP)); err == nil {
+			for _, j := range doc.Select(runtime.GOOS, runtime.GOARCH).J2SE {
+				j2se = append(j2se, j.Version)
+			}
+		}
+		// The built-in runner needs a runtime with argument files
+		minFeature := 0
+		if *_launcher == "java" {
+			minFeature = runnerFeature
+		}
+		javaRuntime := selectRuntime(javaHome, splitPaths(javaPaths), strings.Join(j2se, " "), minFeature)
+
+		javaws := *_javaws
+		if javaws == "" {
+			if javaRuntime != nil && javaRuntime.Javaws != "" {
+				javaws = javaRuntime.Javaws
+			} else {
+				javaws = DefaultJavaPath()
+			}
+		}
+
+		// Without javaws the viewer is run with java directly
+		launcher := *_launcher
+		if launcher == "auto" {
+			launcher = "javaws"
+			if _, err := exec.LookPath(javaws); err != nil {
+				log.Printf("No javaws binary found at %s, running the viewer with java", javaws)
+				launcher = "java"
+				if javaHome == "" && javaRuntime != nil && javaRuntime.Version.Feature < runnerFeature {
+					javaRuntime = selectRuntime("", splitPaths(javaPaths), strings.Join(j2se, " "), runnerFeature)
+				}
+			}
+		}
+
+		// Legacy allowances come from the driver unless configured
+		// for the host, they only apply to this viewer and are based
+		// on the java.security of the runtime running it
+		legacy := session.Legacy()
+		if value, err := cfg.GetValue(*_host, "java_security"); err == nil {
+			if legacy, err = kvm.ParseLegacy(value); err != nil {
+				session.Close()
+				fatalf("Invalid java_security for %s (%s)", *_host, err)
+			}
+		}
+
+		var securityArgs []string
+		if legacy != 0 {
+			java := javaws
+			if launcher == "java" {
+				java = *_java
+				if java == "" && javaRuntime != nil {
+					java = javaRuntime.Java
+				} else if java == "" {
+					java = "java"
+				}
+			}
+			dir, filename, err := writeJavaSecurity(legacy, java)
+			if err != nil {
+				log.Printf("Unable to allow legacy %s, the runtime's java.security is unreadable (%s)", legacy, err)
+			} else {
+				removeOnExit(dir)
+				log.Printf("Allowing legacy %s for this viewer", legacy)
+				securityArgs = append(securityArgs, "-Djava.security.properties="+filename)
+			}
+		}
+
+		if launcher == "java" {
+			if err := runJNLP(*_java, javaRuntime, console.JNLP, securityArgs); err != nil {
+				session.Close()
+				fatalf("Unable to launch DRAC (%s)", err)
+			}
+			break
+		}
+
+		// Check we have access to the javaws binary
+		if _, err := exec.LookPath(javaws); err != nil {
+			session.Close()
+			fatalf("No javaws binary found at %s", javaws)
+		}
+
+		// javaws has to wait for the viewer when there is a session
+		// to log out of afterwards
+		args, blocks := javawsArgs(javaRuntime, *_wait || session.HasSession())
+		keepSession = !blocks
+		for _, arg := range securityArgs {
+			args = append(args, "-J"+arg)
+		}
+		delay := time.Duration(*_delay) * time.Second
+
+		if delivery == "http" {
+			// The jnlp is served once from 127.0.0.1 instead of a file
+			doc, err := jnlp.Parse([]byte(console.JNLP))
+			if err != nil {
+				session.Close()
+				fatalf("Unable to parse DRAC viewer for %s@%s (%s)", username, host, err)
+			}
+			server, err := jnlp.Serve(doc, delay)
+			if err != nil {
+				session.Close()
+				fatalf("Unable to serve DRAC viewer for %s@%s (%s)", username, host, err)
+			}
+
+			// Launch it!
+			log.Printf("Launching KVM session with jnlp served once on 127.0.0.1")
+			args = append(args, server.URL)
+			if err := exec.Command(javaws, args...).Run(); err != nil {
+				server.Close()
+				session.Close()
+				fatalf("Unable to launch DRAC (%s)", err)
+			}
+
+			if !server.Wait() {
+				log.Printf("javaws did not fetch the jnlp within %s", delay)
+			}
+			break
+		}
+
+		filename, err := session.WriteJnlpFile(console.JNLP)
+		if err != nil {
+			session.Close()
+			fatalf("Unable to write DRAC viewer for %s@%s (%s)", username, host, err)
+		}
+		removeOnExit(filepath.Dir(filename))
+
+		// The jnlp is deleted as soon as javaws has read it, --delay
+		// seconds after launch at the latest. There is no watch where
+		// reads can't be seen, the delay is waited out there.
+		watch, err := watchRead(filename)
+		if err != nil {
+			log.Printf("Unable to watch %s (%s)", filename, err)
+		}
+
+		// Launch it! javaws may run for the whole session (-wait,
+		// -Xnofork), the jnlp is removed while it runs
+		log.Printf("Launching KVM session with %s", filename)
+		args = append(args, filename)
+		cmd := exec.Command(javaws, args...)
+		if err := cmd.Start(); err != nil {
+			session.Close()
+			fatalf("Unable to launch DRAC (%s), from file %s", err, filename)
+		}
+
+		if watch != nil {
+			if !watch.Wait(delay) {
+				log.Printf("No complete read of %s seen, removing it anyway", filename)
+			}
+			watch.Close()
+		} else {
+			time.Sleep(delay)
+		}
+		if err := kvm.RemoveJnlpFile(filename); err != nil {
+			log.Printf("Unable to remove %s (%s)", filename, err)
+		}
+
+		if err := cmd.Wait(); err != nil {
+			log.Printf("javaws exited with %s", err)
+		}
+	}
+
+	// Log out of the BMC session the viewer was started with, the
+	// viewer has exited by now unless javaws returned right away
+	if keepSession {
+		log.Printf("Leaving the BMC session open, javaws does not wait for the viewer")
+	} else if err := session.Close(); err != nil {
+		log.Printf("Unable to logout from %s (%s)", host, err)
+	}
+	removeTempDirs()
 }
 
 // EOF
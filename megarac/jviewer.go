@@ -0,0 +1,207 @@
+// -*- go -*-
+
+package megarac
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// KvmMegaracDriver is AMI MegaRAC specific folder for KVM driver.
+type KvmMegaracDriver struct {
+	Host     string
+	Username string
+	Password string
+	Version  int
+
+	InsecureSkipVerify bool
+
+	client  *http.Client
+	session string
+	csrf    string
+}
+
+const (
+	// DefaultUsername is the default username on AMI MegaRAC
+	DefaultUsername = "admin"
+	// DefaultPassword is the default password on AMI MegaRAC
+	DefaultPassword = "admin"
+)
+
+// sessionRe extracts the values of the create.asp answer, which is a
+// javascript object rather than JSON:
+// { 'SESSION_COOKIE' : 'xxx', 'BMC_IP_ADDR' : '10.0.0.1', 'CSRFTOKEN' : 'yyy' }
+var sessionRe = regexp.MustCompile(`'(SESSION_COOKIE|BMC_IP_ADDR|CSRFTOKEN)'\s*:\s*'([^']*)'`)
+
+func init() {
+	kvm.Register(kvm.Vendor{
+		Name:            "megarac",
+		Aliases:         []string{"ami", "asrock"},
+		Description:     "AMI MegaRAC / ASRock Rack JViewer",
+		DefaultUsername: DefaultUsername,
+		DefaultPassword: DefaultPassword,
+		New: func(opts kvm.Options) kvm.Driver {
+			return &KvmMegaracDriver{
+				Host:     opts.Host,
+				Username: opts.Username,
+				Password: opts.Password,
+				Version:  opts.Version,
+
+				InsecureSkipVerify: opts.InsecureSkipVerify,
+			}
+		},
+		Fingerprint: fingerprint,
+		ProbePaths:  probePaths,
+	})
+}
+
+// fingerprint recognizes a MegaRAC by its certificate or Redfish
+// service root
+func fingerprint(p *kvm.Probe) *kvm.Match {
+	var reason string
+
+	if subject := p.CertificateSubject(); strings.Contains(subject, "American Megatrends") {
+		reason = fmt.Sprintf("TLS certificate subject %q", subject)
+	} else if p.RedfishVendor("AMI") {
+		reason = "Redfish service root names AMI"
+	}
+	if reason == "" {
+		return nil
+	}
+
+	return &kvm.Match{Version: -1, Reason: reason}
+}
+
+// probePaths recognizes the MegaRAC login page
+func probePaths(p *kvm.Probe) *kvm.Match {
+	if !p.Contains("/", "MegaRAC") {
+		return nil
+	}
+	return &kvm.Match{Version: -1, Reason: "login page mentions MegaRAC"}
+}
+
+// Viewer creates a web session, downloads jviewer.jnlp with the
+// session cookie and CSRF token and points it at our host
+func (d *KvmMegaracDriver) Viewer() (string, error) {
+	d.client = kvm.NewHTTPClient(d.InsecureSkipVerify)
+
+	values := url.Values{"WEBVAR_USERNAME": {d.Username}, "WEBVAR_PASSWORD": {d.Password}}
+	res, err := d.client.PostForm("https://"+d.Host+"/rpc/WEBSES/create.asp", values)
+	if err != nil {
+		return "", fmt.Errorf("couldn't login to MegaRAC (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't login to MegaRAC (%s)", res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	var bmcAddr string
+	for _, m := range sessionRe.FindAllStringSubmatch(string(body), -1) {
+		switch m[1] {
+		case "SESSION_COOKIE":
+			d.session = m[2]
+		case "BMC_IP_ADDR":
+			bmcAddr = m[2]
+		case "CSRFTOKEN":
+			d.csrf = m[2]
+		}
+	}
+	// Failed logins still come with a SESSION_COOKIE, e.g.
+	// Failure_Login_IPMI_Then_LDAP
+	if d.session == "" || strings.HasPrefix(d.session, "Failure") {
+		d.session = ""
+		return "", fmt.Errorf("login to MegaRAC refused: %w", kvm.ErrAuthFailed)
+	}
+
+	res, err = d.get("/Java/jviewer.jnlp")
+	if err != nil {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp (%s)", res.Status)
+	}
+
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		d.Close()
+		return "", err
+	}
+	if !bytes.Contains(bodyBytes, []byte("<jnlp")) {
+		d.Close()
+		return "", errors.New("no jnlp returned by MegaRAC")
+	}
+
+	doc, err := jnlp.Parse(bodyBytes)
+	if err != nil {
+		d.Close()
+		return "", err
+	}
+
+	// Point the codebase and the viewer arguments at the host we
+	// reached the BMC with rather than its own idea of its address
+	doc.RewriteHost(bmcAddr, d.Host)
+
+	data, err := doc.Marshal()
+	if err != nil {
+		d.Close()
+	}
+	return string(data), err
+}
+
+// get requests path with the session cookie and CSRF token
+func (d *KvmMegaracDriver) get(path string) (*http.Response, error) {
+	req, _ := http.NewRequest("GET", "https://"+d.Host+path, nil)
+	req.AddCookie(&http.Cookie{Name: "SessionCookie", Value: d.session})
+	if d.csrf != "" {
+		req.Header.Set("X-CSRFTOKEN", d.csrf)
+	}
+	return d.client.Do(req)
+}
+
+// Close ends the web session created by Viewer
+func (d *KvmMegaracDriver) Close() error {
+	if d.session == "" {
+		return nil
+	}
+
+	res, err := d.get("/rpc/WEBSES/logout.asp")
+	d.session = ""
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// GetHost return Configured driver Host
+func (d *KvmMegaracDriver) GetHost() string {
+	return d.Host
+}
+
+// GetUsername return Configured driver Username
+func (d *KvmMegaracDriver) GetUsername() string {
+	return d.Username
+}
+
+// GetPassword return Configured driver Password
+func (d *KvmMegaracDriver) GetPassword() string {
+	return d.Password
+}
+
+// EOF
@@ -0,0 +1,255 @@
+// -*- go -*-
+
+package openbmc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// KvmOpenbmcDriver is OpenBMC specific folder for KVM driver.
+type KvmOpenbmcDriver struct {
+	Host     string
+	Username string
+	Password string
+	Version  int
+
+	InsecureSkipVerify bool
+
+	xsrf string
+
+	// mu guards the session, the bridge and its connections, which
+	// serve uses while Close tears them down
+	mu       sync.Mutex
+	client   *http.Client
+	listener net.Listener
+	conns    []io.Closer
+	closed   bool
+}
+
+const (
+	// DefaultUsername is the default username on OpenBMC
+	DefaultUsername = "root"
+	// DefaultPassword is the default password on OpenBMC
+	DefaultPassword = "0penBmc"
+)
+
+func init() {
+	kvm.Register(kvm.Vendor{
+		Name:            "openbmc",
+		Description:     "OpenBMC (VNC viewer through a local bridge)",
+		DefaultUsername: DefaultUsername,
+		DefaultPassword: DefaultPassword,
+		New: func(opts kvm.Options) kvm.Driver {
+			return &KvmOpenbmcDriver{
+				Host:     opts.Host,
+				Username: opts.Username,
+				Password: opts.Password,
+				Version:  opts.Version,
+
+				InsecureSkipVerify: opts.InsecureSkipVerify,
+			}
+		},
+		Fingerprint: fingerprint,
+		ProbePaths:  probePaths,
+	})
+}
+
+// fingerprint recognizes an OpenBMC by its Redfish service root
+func fingerprint(p *kvm.Probe) *kvm.Match {
+	if !p.RedfishVendor("OpenBMC") {
+		return nil
+	}
+	return &kvm.Match{Version: -1, Reason: "Redfish service root names OpenBMC"}
+}
+
+// probePaths recognizes the OpenBMC login page
+func probePaths(p *kvm.Probe) *kvm.Match {
+	if !p.Contains("/", "OpenBMC") {
+		return nil
+	}
+	return &kvm.Match{Version: -1, Reason: "web interface mentions OpenBMC"}
+}
+
+// login opens a cookie session, bmcweb also hands out the XSRF token
+// required for websockets as a cookie
+func (d *KvmOpenbmcDriver) login() error {
+	client := kvm.NewHTTPClient(d.InsecureSkipVerify)
+	client.Jar, _ = cookiejar.New(nil)
+
+	body, _ := json.Marshal(map[string][]string{"data": {d.Username, d.Password}})
+	res, err := client.Post("https://"+d.Host+"/login", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("couldn't login to OpenBMC (%v): %w", err, kvm.ErrUnreachable)
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("login to OpenBMC refused (%s): %w", res.Status, kvm.ErrAuthFailed)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("couldn't login to OpenBMC (%s)", res.Status)
+	}
+
+	for _, cookie := range client.Jar.Cookies(res.Request.URL) {
+		if cookie.Name == "XSRF-TOKEN" {
+			d.xsrf = cookie.Value
+		}
+	}
+
+	d.mu.Lock()
+	d.client = client
+	d.closed = false
+	d.mu.Unlock()
+	return nil
+}
+
+// Console logs in and serves the /kvm/0 websocket as plain RFB on a
+// loopback port to a single viewer connection, the bridge has no
+// authentication of its own
+func (d *KvmOpenbmcDriver) Console() (*kvm.Console, error) {
+	if err := d.login(); err != nil {
+		return nil, err
+	}
+
+	// Check the KVM is available before handing out the bridge
+	ws, err := d.dial()
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	ws.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	d.mu.Lock()
+	d.listener = listener
+	d.mu.Unlock()
+	go d.serve(listener)
+
+	log.Printf("Bridging OpenBMC KVM to %s", listener.Addr())
+	return &kvm.Console{Kind: kvm.VNCConsole, Addr: listener.Addr().String()}, nil
+}
+
+// dial opens the KVM websocket with the session of login
+func (d *KvmOpenbmcDriver) dial() (*wsConn, error) {
+	header := http.Header{}
+	// bmcweb checks the XSRF token of cookie sessions against the
+	// websocket subprotocol
+	if d.xsrf != "" {
+		header.Set("Sec-WebSocket-Protocol", d.xsrf)
+	}
+	d.mu.Lock()
+	client := d.client
+	d.mu.Unlock()
+	if client == nil {
+		return nil, errors.New("session to OpenBMC closed")
+	}
+	ws, err := dialWebsocket(client, "https://"+d.Host+"/kvm/0", header)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open OpenBMC KVM (%v): %w", err, kvm.ErrUnreachable)
+	}
+	return ws, nil
+}
+
+// serve bridges the first viewer connection to a new KVM websocket
+// and stops listening, nobody else can get at the console through our
+// session
+func (d *KvmOpenbmcDriver) serve(listener net.Listener) {
+	conn, err := listener.Accept()
+	listener.Close()
+	if err != nil {
+		return
+	}
+
+	ws, err := d.dial()
+	if err != nil {
+		log.Printf("Unable to bridge viewer connection (%s)", err)
+		conn.Close()
+		return
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		ws.Close()
+		conn.Close()
+		return
+	}
+	d.conns = append(d.conns, conn, ws)
+	d.mu.Unlock()
+
+	go func() {
+		io.Copy(ws, conn)
+		ws.Close()
+	}()
+	io.Copy(conn, ws)
+	conn.Close()
+}
+
+// Viewer is not supported, OpenBMC has no Java viewer
+func (d *KvmOpenbmcDriver) Viewer() (string, error) {
+	return "", fmt.Errorf("no Java viewer on OpenBMC, only a VNC console: %w", kvm.ErrUnsupportedVersion)
+}
+
+// Close stops the bridge and logs out of the session
+func (d *KvmOpenbmcDriver) Close() error {
+	d.mu.Lock()
+	d.closed = true
+	listener, conns, client := d.listener, d.conns, d.client
+	d.listener, d.conns, d.client = nil, nil, nil
+	d.mu.Unlock()
+
+	if listener != nil {
+		listener.Close()
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+
+	if client == nil {
+		return nil
+	}
+
+	req, _ := http.NewRequest("POST", "https://"+d.Host+"/logout", strings.NewReader(`{"data":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	if d.xsrf != "" {
+		req.Header.Set("X-XSRF-TOKEN", d.xsrf)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// GetHost return Configured driver Host
+func (d *KvmOpenbmcDriver) GetHost() string {
+	return d.Host
+}
+
+// GetUsername return Configured driver Username
+func (d *KvmOpenbmcDriver) GetUsername() string {
+	return d.Username
+}
+
+// GetPassword return Configured driver Password
+func (d *KvmOpenbmcDriver) GetPassword() string {
+	return d.Password
+}
+
+// EOF
@@ -0,0 +1,202 @@
+// -*- go -*-
+
+package oracle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// KvmOracleDriver is Oracle/Sun specific folder for KVM driver.
+type KvmOracleDriver struct {
+	Host     string
+	Username string
+	Password string
+	Version  int
+
+	InsecureSkipVerify bool
+
+	client *http.Client
+}
+
+const (
+	// DefaultUsername is the default username on Oracle ILOM
+	DefaultUsername = "root"
+	// DefaultPassword is the default password on Oracle ILOM
+	DefaultPassword = "changeme"
+)
+
+// firmwareRe extracts the ILOM firmware version from its login page,
+// e.g. "Integrated Lights Out Manager ... Version 3.2.4.52"
+var firmwareRe = regexp.MustCompile(`Version\s+(\d+)\.(\d+)[\d.]*`)
+
+func init() {
+	kvm.Register(kvm.Vendor{
+		Name:            "oracle",
+		Aliases:         []string{"ilom", "sun"},
+		Description:     "Oracle/Sun ILOM",
+		DefaultUsername: DefaultUsername,
+		DefaultPassword: DefaultPassword,
+		Versions:        []int{3, 4, 5},
+		New: func(opts kvm.Options) kvm.Driver {
+			return &KvmOracleDriver{
+				Host:     opts.Host,
+				Username: opts.Username,
+				Password: opts.Password,
+				Version:  opts.Version,
+
+				InsecureSkipVerify: opts.InsecureSkipVerify,
+			}
+		},
+		Fingerprint: fingerprint,
+		ProbePaths:  probePaths,
+	})
+}
+
+// fingerprint recognizes an ILOM by its certificate
+func fingerprint(p *kvm.Probe) *kvm.Match {
+	var reason string
+
+	if subject := p.CertificateSubject(); strings.Contains(subject, "Oracle") || strings.Contains(subject, "Sun Microsystems") {
+		reason = fmt.Sprintf("TLS certificate subject %q", subject)
+	}
+	if reason == "" {
+		return nil
+	}
+	return match(p, reason)
+}
+
+// probePaths recognizes the ILOM login page
+func probePaths(p *kvm.Probe) *kvm.Match {
+	if !p.Contains("/iPages/i_login.asp", "Integrated Lights Out Manager") {
+		return nil
+	}
+	return match(p, "login page mentions Integrated Lights Out Manager")
+}
+
+// match returns a Match with the ILOM version when the login page
+// tells it
+func match(p *kvm.Probe, reason string) *kvm.Match {
+	version := -1
+	if res, err := p.Get("/iPages/i_login.asp"); err == nil {
+		if m := firmwareRe.FindSubmatch(res.Body); m != nil {
+			version, _ = strconv.Atoi(string(m[1]))
+		}
+	}
+	return &kvm.Match{Version: version, Reason: reason}
+}
+
+// detectVersion reads the ILOM firmware version from the login page
+func (d *KvmOracleDriver) detectVersion() {
+	res, err := d.client.Get("https://" + d.Host + "/iPages/i_login.asp")
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	body, _ := ioutil.ReadAll(res.Body)
+	if m := firmwareRe.FindSubmatch(body); m != nil {
+		if d.Version < 0 {
+			d.Version, _ = strconv.Atoi(string(m[1]))
+		}
+		log.Printf("Found ILOM %d with firmware %s", d.Version, bytes.TrimPrefix(m[0], []byte("Version ")))
+	}
+}
+
+// Viewer logs in through the ILOM login form and downloads the
+// remote console JNLP for that session
+func (d *KvmOracleDriver) Viewer() (string, error) {
+	d.client = kvm.NewHTTPClient(d.InsecureSkipVerify)
+	d.client.Jar, _ = cookiejar.New(nil)
+
+	d.detectVersion()
+
+	values := url.Values{"username": {d.Username}, "password": {d.Password}}
+	res, err := d.client.PostForm("https://"+d.Host+"/iPages/loginProcessor.asp", values)
+	if err != nil {
+		d.client = nil
+		return "", fmt.Errorf("couldn't login to ILOM (%v): %w", err, kvm.ErrUnreachable)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		d.client = nil
+		return "", fmt.Errorf("couldn't login to ILOM (%s)", res.Status)
+	}
+	// A refused login sends the form back instead of the main frame
+	if bytes.Contains(body, []byte("loginProcessor.asp")) {
+		d.client = nil
+		return "", fmt.Errorf("ILOM login refused: %w", kvm.ErrAuthFailed)
+	}
+
+	res, err = d.client.Get("https://" + d.Host + "/iPages/kvmslaunch.jnlp")
+	if err != nil {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp (%s)", res.Status)
+	}
+
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		d.Close()
+		return "", err
+	}
+	if !bytes.Contains(body, []byte("<jnlp")) {
+		d.Close()
+		return "", errors.New("ILOM did not return a jnlp")
+	}
+	viewer, err := jnlp.Normalize(body)
+	if err != nil {
+		d.Close()
+	}
+	return viewer, err
+}
+
+// Close logs out of the ILOM session opened by Viewer
+func (d *KvmOracleDriver) Close() error {
+	if d.client == nil {
+		return nil
+	}
+	client := d.client
+	d.client = nil
+
+	res, err := client.Get("https://" + d.Host + "/iPages/logout.asp")
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// GetHost return Configured driver Host
+func (d *KvmOracleDriver) GetHost() string {
+	return d.Host
+}
+
+// GetUsername return Configured driver Username
+func (d *KvmOracleDriver) GetUsername() string {
+	return d.Username
+}
+
+// GetPassword return Configured driver Password
+func (d *KvmOracleDriver) GetPassword() string {
+	return d.Password
+}
+
+// EOF
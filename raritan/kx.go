@@ -0,0 +1,174 @@
+// -*- go -*-
+
+package raritan
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
+)
+
+// KvmRaritanDriver is Raritan Dominion KX specific folder for KVM driver.
+type KvmRaritanDriver struct {
+	Host     string
+	Username string
+	Password string
+	Version  int
+	Port     int
+
+	InsecureSkipVerify bool
+
+	client *http.Client
+}
+
+const (
+	// DefaultUsername is the default username on Raritan Dominion KX
+	DefaultUsername = "admin"
+	// DefaultPassword is the default password on Raritan Dominion KX
+	DefaultPassword = "raritan"
+)
+
+func init() {
+	kvm.Register(kvm.Vendor{
+		Name:            "raritan",
+		Aliases:         []string{"kx", "dominion"},
+		Description:     "Raritan Dominion KX switch (needs --port)",
+		DefaultUsername: DefaultUsername,
+		DefaultPassword: DefaultPassword,
+		New: func(opts kvm.Options) kvm.Driver {
+			return &KvmRaritanDriver{
+				Host:     opts.Host,
+				Username: opts.Username,
+				Password: opts.Password,
+				Version:  opts.Version,
+				Port:     opts.Port,
+
+				InsecureSkipVerify: opts.InsecureSkipVerify,
+			}
+		},
+		Fingerprint: fingerprint,
+		ProbePaths:  probePaths,
+	})
+}
+
+// fingerprint recognizes a Dominion KX by its certificate
+func fingerprint(p *kvm.Probe) *kvm.Match {
+	subject := p.CertificateSubject()
+	if !strings.Contains(subject, "Raritan") {
+		return nil
+	}
+	return &kvm.Match{Version: -1, Reason: fmt.Sprintf("TLS certificate subject %q", subject)}
+}
+
+// probePaths recognizes the Dominion KX login page
+func probePaths(p *kvm.Probe) *kvm.Match {
+	if !p.Contains("/", "Dominion KX") {
+		return nil
+	}
+	return &kvm.Match{Version: -1, Reason: "login page mentions Dominion KX"}
+}
+
+// Viewer logs in to the switch and downloads the remote console
+// JNLP connected to the target port
+func (d *KvmRaritanDriver) Viewer() (string, error) {
+	if d.Port <= 0 {
+		return "", fmt.Errorf("no target port given for %s: %w", d.Host, kvm.ErrPortRequired)
+	}
+
+	d.client = kvm.NewHTTPClient(d.InsecureSkipVerify)
+	d.client.Jar, _ = cookiejar.New(nil)
+
+	values := url.Values{"login": {d.Username}, "password": {d.Password}, "action": {"login"}}
+	res, err := d.client.PostForm("https://"+d.Host+"/auth.asp", values)
+	if err != nil {
+		d.client = nil
+		return "", fmt.Errorf("couldn't login to Dominion KX (%v): %w", err, kvm.ErrUnreachable)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		d.client = nil
+		return "", fmt.Errorf("couldn't login to Dominion KX (%s)", res.Status)
+	}
+
+	loggedIn := false
+	for _, cookie := range d.client.Jar.Cookies(res.Request.URL) {
+		if cookie.Name == "pp_session_id" && cookie.Value != "" {
+			loggedIn = true
+		}
+	}
+	if !loggedIn {
+		d.client = nil
+		return "", fmt.Errorf("login to Dominion KX refused: %w", kvm.ErrAuthFailed)
+	}
+
+	log.Printf("Connecting to Dominion KX port %d", d.Port)
+	values = url.Values{"portId": {strconv.Itoa(d.Port)}}
+	res, err = d.client.Get("https://" + d.Host + "/rc.jnlp?" + values.Encode())
+	if err != nil {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		d.Close()
+		return "", fmt.Errorf("couldn't fetch jnlp for port %d (%s)", d.Port, res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		d.Close()
+		return "", err
+	}
+	if !bytes.Contains(body, []byte("<jnlp")) {
+		d.Close()
+		return "", errors.New("no jnlp returned by Dominion KX")
+	}
+	viewer, err := jnlp.Normalize(body)
+	if err != nil {
+		d.Close()
+	}
+	return viewer, err
+}
+
+// Close logs out of the switch session opened by Viewer
+func (d *KvmRaritanDriver) Close() error {
+	if d.client == nil {
+		return nil
+	}
+	client := d.client
+	d.client = nil
+
+	res, err := client.PostForm("https://"+d.Host+"/auth.asp", url.Values{"action": {"logout"}})
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// GetHost return Configured driver Host
+func (d *KvmRaritanDriver) GetHost() string {
+	return d.Host
+}
+
+// GetUsername return Configured driver Username
+func (d *KvmRaritanDriver) GetUsername() string {
+	return d.Username
+}
+
+// GetPassword return Configured driver Password
+func (d *KvmRaritanDriver) GetPassword() string {
+	return d.Password
+}
+
+// EOF
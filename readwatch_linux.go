@@ -0,0 +1,93 @@
+// -*- go -*-
+
+package main
+
+import (
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// readGrace is how long a read file has to stay closed before it is
+// considered done with, javaws opens the JNLP more than once
+const readGrace = 2 * time.Second
+
+// readWatch follows the reads of a file with inotify
+type readWatch struct {
+	fd int
+}
+
+// watchRead starts watching filename for reads
+func watchRead(filename string) (*readWatch, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := unix.InotifyAddWatch(fd, filename, unix.IN_OPEN|unix.IN_CLOSE_NOWRITE); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return &readWatch{fd: fd}, nil
+}
+
+// Wait returns true once the file has been read and closed for
+// readGrace, or false when timeout passes without a complete read
+func (w *readWatch) Wait(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	opened, read := 0, false
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+
+	for {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return read && opened == 0
+		}
+		if read && opened == 0 && wait > readGrace {
+			wait = readGrace
+		}
+
+		fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(wait/time.Millisecond))
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return false
+		}
+		if n == 0 {
+			if read && opened == 0 {
+				return true
+			}
+			continue
+		}
+
+		n, err = unix.Read(w.fd, buf)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return false
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			if event.Mask&unix.IN_OPEN != 0 {
+				opened++
+			}
+			if event.Mask&unix.IN_CLOSE_NOWRITE != 0 {
+				if opened > 0 {
+					opened--
+				}
+				read = true
+			}
+			offset += unix.SizeofInotifyEvent + int(event.Len)
+		}
+	}
+}
+
+// Close stops watching
+func (w *readWatch) Close() error {
+	return unix.Close(w.fd)
+}
+
+// EOF
@@ -0,0 +1,30 @@
+// -*- go -*-
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import "time"
+
+// readWatch has no way to see reads here, watchRead hands out none
+// and the file is kept for the whole timeout
+type readWatch struct{}
+
+// watchRead returns no watch, reads can't be seen on this platform
+func watchRead(filename string) (*readWatch, error) {
+	return nil, nil
+}
+
+// Wait sleeps for timeout and returns false
+func (w *readWatch) Wait(timeout time.Duration) bool {
+	time.Sleep(timeout)
+	return false
+}
+
+// Close stops watching
+func (w *readWatch) Close() error {
+	return nil
+}
+
+// EOF
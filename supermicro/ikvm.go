@@ -6,17 +6,26 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
-	"text/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/utsl42/drac-kvm/jnlp"
+	"github.com/utsl42/drac-kvm/kvm"
 )
 
 // KvmSupermicroDriver is Supermicro specific folder for KVM driver.
-//
 type KvmSupermicroDriver struct {
 	Host     string
 	Username string
 	Password string
 	Version  int
+
+	InsecureSkipVerify bool
 }
 
 const (
@@ -32,21 +41,175 @@ var SupermicroTemplates = map[int]string{
 	169: ikvm169,
 }
 
-// Viewer returns a viewer.jnlp template filled out with the
-// necessary details to connect to a particular DRAC host
+// fallbackVersion is the template used when the JNLP could not be
+// fetched from the BMC and no version was given
+const fallbackVersion = 169
+
+// jarVersionRe extracts the iKVM version from the viewer jar name,
+// e.g. iKVM__V1.69.21.0x0.jar is version 169
+var jarVersionRe = regexp.MustCompile(`iKVM__V(\d+)\.(\d+)`)
+
+func init() {
+	kvm.Register(kvm.Vendor{
+		Name:            "supermicro",
+		Aliases:         []string{"smc", "aten"},
+		Description:     "Supermicro ATEN iKVM",
+		DefaultUsername: DefaultUsername,
+		DefaultPassword: DefaultPassword,
+		New: func(opts kvm.Options) kvm.Driver {
+			return &KvmSupermicroDriver{
+				Host:     opts.Host,
+				Username: opts.Username,
+				Password: opts.Password,
+				Version:  opts.Version,
+
+				InsecureSkipVerify: opts.InsecureSkipVerify,
+			}
+		},
+		Fingerprint: fingerprint,
+		ProbePaths:  probePaths,
+	})
+}
+
+// fingerprint recognizes a Supermicro BMC by its certificate,
+// Redfish service root or its CGI login endpoint
+func fingerprint(p *kvm.Probe) *kvm.Match {
+	var reason string
+
+	if subject := p.CertificateSubject(); strings.Contains(subject, "Super Micro") {
+		reason = fmt.Sprintf("TLS certificate subject %q", subject)
+	} else if p.RedfishVendor("Supermicro") {
+		reason = "Redfish service root names Supermicro"
+	}
+	if reason == "" {
+		return nil
+	}
+
+	return &kvm.Match{Version: -1, Reason: reason}
+}
+
+// probePaths recognizes the ATEN login page, its form posts to
+// /cgi/login.cgi
+func probePaths(p *kvm.Probe) *kvm.Match {
+	if !p.Contains("/", "/cgi/login.cgi") {
+		return nil
+	}
+	return &kvm.Match{Version: -1, Reason: "login page posts to /cgi/login.cgi"}
+}
+
+// Viewer logs in to the BMC and returns the launch JNLP it hands out,
+// which matches the iKVM jars of the installed firmware. The static
+// templates are only used when the JNLP could not be fetched.
 func (d *KvmSupermicroDriver) Viewer() (string, error) {
+	jnlp, err := d.fetchViewer()
+	if err == nil {
+		if m := jarVersionRe.FindStringSubmatch(jnlp); m != nil {
+			major, _ := strconv.Atoi(m[1])
+			minor, _ := strconv.Atoi(m[2])
+			d.Version = major*100 + minor
+		}
+		log.Printf("Found iKVM version %d", d.Version)
+		return jnlp, nil
+	}
+	// The template carries the password, it is only used on firmware
+	// without the launch endpoint, not when the BMC is unreachable or
+	// refused the login
+	if !errors.Is(err, errNoLaunchJNLP) {
+		return "", err
+	}
+
+	log.Printf("Unable to fetch iKVM viewer from BMC (%s), using template", err)
+	return d.templateViewer()
+}
+
+// errNoLaunchJNLP is returned by fetchViewer when the firmware has no
+// launch JNLP endpoint, the only case the template is used for
+var errNoLaunchJNLP = errors.New("BMC has no launch jnlp")
+
+// fetchViewer logs in via /cgi/login.cgi and downloads the
+// launch JNLP using the SID session cookie
+func (d *KvmSupermicroDriver) fetchViewer() (string, error) {
+	client := kvm.NewHTTPClient(d.InsecureSkipVerify)
+
+	values := url.Values{"name": {d.Username}, "pwd": {d.Password}}
+	res, err := client.PostForm("https://"+d.Host+"/cgi/login.cgi", values)
+	if err != nil {
+		return "", fmt.Errorf("couldn't login to BMC (%v): %w", err, kvm.ErrUnreachable)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		return "", fmt.Errorf("couldn't login to BMC (%s)", res.Status)
+	}
+
+	var sid *http.Cookie
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == "SID" && cookie.Value != "" {
+			sid = cookie
+		}
+	}
+	if sid == nil {
+		return "", fmt.Errorf("no SID cookie in BMC login response: %w", kvm.ErrAuthFailed)
+	}
+
+	req, _ := http.NewRequest("GET", "https://"+d.Host+"/cgi/url_redirect.cgi?url_name=ikvm&url_type=jwsk", nil)
+	req.AddCookie(&http.Cookie{Name: "SID", Value: sid.Value})
+
+	res, err = client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("couldn't fetch jnlp (%v): %w", err, kvm.ErrUnreachable)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w (%s)", errNoLaunchJNLP, res.Status)
+	}
+	if res.StatusCode != 200 {
+		return "", fmt.Errorf("couldn't fetch jnlp (%s)", res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Contains(body, []byte("<jnlp")) {
+		return "", fmt.Errorf("%w (no jnlp returned)", errNoLaunchJNLP)
+	}
+	viewer, err := jnlp.Normalize(body)
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", errNoLaunchJNLP, err)
+	}
+	return viewer, nil
+}
+
+// templateViewer returns a viewer.jnlp template filled out with the
+// necessary details to connect to a particular BMC host
+func (d *KvmSupermicroDriver) templateViewer() (string, error) {
+	if d.Version < 0 {
+		d.Version = fallbackVersion
+	}
 
 	if _, ok := SupermicroTemplates[d.Version]; !ok {
-		msg := fmt.Sprintf("no support for iKVM v%d", d.Version)
-		return "", errors.New(msg)
+		return "", fmt.Errorf("no support for iKVM v%d: %w", d.Version, kvm.ErrUnsupportedVersion)
 	}
 
-	log.Printf("Found iKVM version %d", d.Version)
+	log.Printf("Using iKVM version %d template", d.Version)
 	// Generate a JNLP viewer from the template
 	// Injecting the host/user/pass information
-	buff := bytes.NewBufferString("")
-	err := template.Must(template.New("viewer").Parse(SupermicroTemplates[d.Version])).Execute(buff, d)
-	return buff.String(), err
+	return jnlp.Execute(SupermicroTemplates[d.Version], map[string]string{
+		"Host":     d.Host,
+		"Username": d.Username,
+		"Password": d.Password,
+	})
+}
+
+// Firmware returns the iKVM version, viewer jars are cached per version
+func (d *KvmSupermicroDriver) Firmware() string {
+	return strconv.Itoa(d.Version)
+}
+
+// Legacy returns what the ATEN iKVM viewer needs, its firmware only
+// does TLS 1.0 with 1024-bit keys and its jars are MD5 signed
+func (d *KvmSupermicroDriver) Legacy() kvm.Legacy {
+	return kvm.LegacyAll
 }
 
 // GetHost return Configured driver Host
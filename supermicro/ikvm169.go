@@ -2,8 +2,7 @@
 
 package supermicro
 
-const ikvm169 string = `
-<jnlp spec="1.0+" codebase="https://{{ .Host }}:443/">
+const ikvm169 string = `<jnlp spec="1.0+" codebase="https://{{ .Host }}:443/">
   <information>
     <title>ATEN Java iKVM Viewer</title>
     <vendor>ATEN</vendor>
@@ -0,0 +1,91 @@
+// -*- go -*-
+
+package main
+
+import (
+	"crypto/des"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// vncPasswordKey is the fixed DES key of VNC password files, given
+// with the bits of each byte reversed as d3des expects them
+var vncPasswordKey = []byte{0xe8, 0x4a, 0xd6, 0x60, 0xc4, 0x72, 0x1a, 0xe0}
+
+// obfuscateVNCPassword encrypts password the way vncpasswd does, only
+// its first 8 characters are significant
+func obfuscateVNCPassword(password string) []byte {
+	block, _ := des.NewCipher(vncPasswordKey)
+
+	plain := make([]byte, 8)
+	copy(plain, password)
+	obfuscated := make([]byte, 8)
+	block.Encrypt(obfuscated, plain)
+	return obfuscated
+}
+
+// writeVNCPasswordFile writes a VNC password file into a new private
+// directory, the caller removes the directory once the viewer exits
+func writeVNCPasswordFile(password string) (dir string, filename string, err error) {
+	dir, err = ioutil.TempDir("", "drac-kvm")
+	if err != nil {
+		return "", "", err
+	}
+
+	filename = filepath.Join(dir, "passwd")
+	if err := ioutil.WriteFile(filename, obfuscateVNCPassword(password), 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return dir, filename, nil
+}
+
+// runVNCViewer runs the VNC viewer command against addr until it
+// exits, passwordFile is handed to vncviewer compatible viewers. It
+// only fails when the viewer can't be started, how the session ended
+// is logged.
+func runVNCViewer(viewer string, addr string, passwordFile string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	args := strings.Fields(viewer)
+	if len(args) == 0 {
+		return errors.New("no VNC viewer command given")
+	}
+
+	log.Printf("Launching VNC viewer %s on %s", viewer, addr)
+	switch strings.TrimSuffix(filepath.Base(args[0]), ".exe") {
+	case "remmina":
+		if passwordFile != "" {
+			log.Printf("Remmina can't read VNC password files, enter the password yourself")
+		}
+		args = append(args, "-c", "vnc://"+addr)
+	default:
+		// host::port is understood by TigerVNC, TightVNC and RealVNC
+		if passwordFile != "" {
+			args = append(args, "-passwd", passwordFile)
+		}
+		args = append(args, host+"::"+port)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		log.Printf("VNC viewer exited with %s", err)
+	}
+	return nil
+}
+
+// EOF
@@ -0,0 +1,28 @@
+// -*- go -*-
+
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestObfuscateVNCPassword(t *testing.T) {
+	tests := []struct {
+		password string
+		want     string
+	}{
+		{"password", "dbd83cfd727a1458"},
+		// Only the first 8 characters count
+		{"password123", "dbd83cfd727a1458"},
+		// Shorter passwords are padded with NULs
+		{"", "5ab2cdc0badcaf13"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(obfuscateVNCPassword(tt.password)); got != tt.want {
+			t.Errorf("obfuscateVNCPassword(%q) = %s, want %s", tt.password, got, tt.want)
+		}
+	}
+}
+
+// EOF